@@ -4,9 +4,11 @@ go 1.17
 
 require (
 	github.com/bitly/go-simplejson v0.5.0
+	github.com/google/uuid v1.3.0
 	github.com/grafadruid/go-druid v0.0.6
 	github.com/grafana/grafana-plugin-sdk-go v0.140.0
 	github.com/magefile/mage v1.13.0
+	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
 )
 
 require (
@@ -27,7 +29,6 @@ require (
 	github.com/google/flatbuffers v2.0.0+incompatible // indirect
 	github.com/google/go-cmp v0.5.7 // indirect
 	github.com/google/go-querystring v1.0.0 // indirect
-	github.com/google/uuid v1.3.0 // indirect
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0 // indirect
 	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0 // indirect
@@ -55,7 +56,6 @@ require (
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
-	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
 	golang.org/x/sys v0.0.0-20220114195835-da31bd327af9 // indirect
 	golang.org/x/text v0.3.6 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Maximum number of values listed for an ad hoc filter key
+const tagValuesLimit = 1000
+
+// Query types which can be filtered
+var filterQueryTypes = map[string]bool{
+	"timeseries":   true,
+	"topN":         true,
+	"groupBy":      true,
+	"scan":         true,
+	"search":       true,
+	"timeBoundary": true,
+}
+
+// Keywords ending the WHERE clause of a SQL query
+var sqlClauseRegexp = regexp.MustCompile(`(?i)^(WHERE|GROUP\s+BY|HAVING|ORDER\s+BY|LIMIT|OFFSET|UNION|INTERSECT|EXCEPT|WINDOW)\b`)
+
+// Keywords combining the results of several SELECT
+var sqlSetOperatorRegexp = regexp.MustCompile(`(?i)^(UNION|INTERSECT|EXCEPT)\b`)
+
+// adhocFilter is a filter of a Grafana ad hoc filters variable.
+type adhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// withAdhocFilters adds ad hoc filters to the filter of a native query.
+func withAdhocFilters(builder map[string]interface{}, filters []adhocFilter) error {
+	queryType, _ := builder["queryType"].(string)
+	if len(filters) == 0 || !filterQueryTypes[queryType] {
+		return nil
+	}
+	var fields []interface{}
+	if f, ok := builder["filter"]; ok && f != nil {
+		fields = append(fields, f)
+	}
+	for _, f := range filters {
+		nf, err := nativeAdhocFilter(f)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, nf)
+	}
+	builder["filter"] = map[string]interface{}{"type": "and", "fields": fields}
+	return nil
+}
+
+func nativeAdhocFilter(f adhocFilter) (map[string]interface{}, error) {
+	switch f.Operator {
+	case "=":
+		return map[string]interface{}{"type": "selector", "dimension": f.Key, "value": f.Value}, nil
+	case "!=":
+		return map[string]interface{}{"type": "not", "field": map[string]interface{}{"type": "selector", "dimension": f.Key, "value": f.Value}}, nil
+	case "=~":
+		return map[string]interface{}{"type": "regex", "dimension": f.Key, "pattern": f.Value}, nil
+	case "!~":
+		return map[string]interface{}{"type": "not", "field": map[string]interface{}{"type": "regex", "dimension": f.Key, "pattern": f.Value}}, nil
+	case "<":
+		return map[string]interface{}{"type": "bound", "dimension": f.Key, "upper": f.Value, "upperStrict": true, "ordering": boundOrdering(f.Value)}, nil
+	case ">":
+		return map[string]interface{}{"type": "bound", "dimension": f.Key, "lower": f.Value, "lowerStrict": true, "ordering": boundOrdering(f.Value)}, nil
+	}
+	return nil, fmt.Errorf("ad hoc filter on %s: unsupported operator %s", f.Key, f.Operator)
+}
+
+func boundOrdering(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "numeric"
+	}
+	return "lexicographic"
+}
+
+// sqlWithAdhocFilters adds ad hoc filters to the WHERE clause of the outermost
+// SELECT of a SQL query, creating it if needed. Compound queries (UNION,
+// INTERSECT, EXCEPT) are refused, as filtering only one of their SELECT would
+// be misleading.
+func sqlWithAdhocFilters(sql string, filters []adhocFilter) (string, error) {
+	if len(filters) == 0 {
+		return sql, nil
+	}
+	var conditions []string
+	for _, f := range filters {
+		c, err := sqlAdhocFilter(f)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, c)
+	}
+	condition := strings.Join(conditions, " AND ")
+	// comments could hide the clauses, or the filters added after them
+	sql = strings.TrimRight(strings.TrimSpace(stripSQLComments(sql)), ";")
+	clauses := topLevelClauses(sql)
+	where := -1
+	for i, c := range clauses {
+		if sqlSetOperatorRegexp.MatchString(sql[c:]) {
+			return "", errors.New("ad hoc filters can't apply to compound SQL queries")
+		}
+		if where < 0 && strings.EqualFold(sql[c:c+5], "WHERE") {
+			where = i
+		}
+	}
+	if where < 0 {
+		// the WHERE clause comes before the first clause following it
+		end := len(sql)
+		if len(clauses) > 0 {
+			end = clauses[0]
+		}
+		return strings.TrimSpace(strings.TrimSpace(sql[:end]) + " WHERE " + condition + " " + sql[end:]), nil
+	}
+	start := clauses[where] + len("WHERE")
+	end := len(sql)
+	if where+1 < len(clauses) {
+		end = clauses[where+1]
+	}
+	return strings.TrimSpace(sql[:start] + " " + condition + " AND (" + strings.TrimSpace(sql[start:end]) + ") " + sql[end:]), nil
+}
+
+// topLevelClauses returns the positions of the clauses keywords which are
+// neither in sub queries nor in string literals or quoted identifiers.
+func topLevelClauses(sql string) []int {
+	var positions []int
+	depth := 0
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (i == 0 || !isIdentifierChar(sql[i-1])) && sqlClauseRegexp.MatchString(sql[i:]):
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// stripSQLComments replaces the comments of a SQL query with spaces, leaving
+// string literals and quoted identifiers as is.
+func stripSQLComments(sql string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return b.String()
+			}
+			i += end
+			c = '\n'
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+			c = ' '
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func sqlAdhocFilter(f adhocFilter) (string, error) {
+	column := sqlIdentifier(f.Key)
+	switch f.Operator {
+	case "=":
+		return fmt.Sprintf("%s = %s", column, sqlString(f.Value)), nil
+	case "!=":
+		return fmt.Sprintf("%s <> %s", column, sqlString(f.Value)), nil
+	case "=~":
+		return fmt.Sprintf("REGEXP_LIKE(%s, %s)", column, sqlString(f.Value)), nil
+	case "!~":
+		return fmt.Sprintf("NOT REGEXP_LIKE(%s, %s)", column, sqlString(f.Value)), nil
+	case "<", ">":
+		value := sqlString(f.Value)
+		if _, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			value = f.Value
+		}
+		return fmt.Sprintf("%s %s %s", column, f.Operator, value), nil
+	}
+	return "", fmt.Errorf("ad hoc filter on %s: unsupported operator %s", f.Key, f.Operator)
+}
+
+func sqlIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func sqlString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// tagsRequest is the body of the ad hoc filters keys and values resources.
+type tagsRequest struct {
+	Datasource string `json:"datasource"`
+	Key        string `json:"key"`
+	From       int64  `json:"from"`
+	To         int64  `json:"to"`
+}
+
+func (ds *druidDatasource) prepareTagsRequest(req *backend.CallResourceRequest, s *druidInstanceSettings) (tagsRequest, error) {
+	var r tagsRequest
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &r); err != nil {
+			return r, err
+		}
+	}
+	if r.Datasource == "" {
+		r.Datasource, _ = s.defaultQuerySettings["adhocFiltersDatasource"].(string)
+	}
+	if r.Datasource == "" {
+		return r, errors.New("no datasource to get ad hoc filters from, set one in the datasource query defaults")
+	}
+	return r, nil
+}
+
+// TagKeys lists the columns of the Druid datasource ad hoc filters apply on.
+func (ds *druidDatasource) TagKeys(ctx context.Context, req *backend.CallResourceRequest) ([]grafanaMetricFindValue, error) {
+	response := []grafanaMetricFindValue{}
+	s, err := ds.settings(req.PluginContext)
+	if err != nil {
+		return response, err
+	}
+	ctx = s.identity.withIdentity(ctx, resourceHeaders(req.Headers), req.PluginContext.User)
+	r, err := ds.prepareTagsRequest(req, s)
+	if err != nil {
+		return response, err
+	}
+	columns := s.catalog.columnTypes(ctx, ds, s, r.Datasource)
+	if columns == nil {
+		return response, fmt.Errorf("can't get the columns of datasource %s", r.Datasource)
+	}
+	var names []string
+	for name := range columns {
+		if name != "__time" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		response = append(response, grafanaMetricFindValue{Value: name, Text: name})
+	}
+	return response, nil
+}
+
+// TagValues lists the most frequent values of a column over the time range, if any.
+func (ds *druidDatasource) TagValues(ctx context.Context, req *backend.CallResourceRequest) ([]grafanaMetricFindValue, error) {
+	response := []grafanaMetricFindValue{}
+	s, err := ds.settings(req.PluginContext)
+	if err != nil {
+		return response, err
+	}
+	ctx = s.identity.withIdentity(ctx, resourceHeaders(req.Headers), req.PluginContext.User)
+	r, err := ds.prepareTagsRequest(req, s)
+	if err != nil {
+		return response, err
+	}
+	if r.Key == "" {
+		return response, errors.New("missing key")
+	}
+	column := sqlIdentifier(r.Key)
+	where := ""
+	var parameters []sqlParameter
+	if r.From > 0 && r.To > 0 {
+		where = `WHERE "__time" BETWEEN MILLIS_TO_TIMESTAMP(?) AND MILLIS_TO_TIMESTAMP(?)`
+		parameters = []sqlParameter{{Type: "BIGINT", Value: r.From}, {Type: "BIGINT", Value: r.To}}
+	}
+	q := &sqlQuery{
+		SQL: druidquery.NewSQL().
+			SetQuery(fmt.Sprintf(`SELECT %s FROM %s %s GROUP BY 1 ORDER BY COUNT(*) DESC LIMIT %d`, column, sqlIdentifier(r.Datasource), where, tagValuesLimit)).
+			SetResultFormat("array"),
+		Parameters: parameters,
+	}
+	var rows [][]interface{}
+	if err := ds.runQuery(ctx, q, s, &rows); err != nil {
+		return response, err
+	}
+	for _, row := range rows {
+		if len(row) != 1 || row[0] == nil {
+			continue
+		}
+		text, ok := row[0].(string)
+		if !ok {
+			text = toJSONString(row[0])
+		}
+		response = append(response, grafanaMetricFindValue{Value: text, Text: text})
+	}
+	return response, nil
+}
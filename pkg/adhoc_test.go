@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSQLWithAdhocFilters(t *testing.T) {
+	filters := []adhocFilter{{Key: "page", Operator: "=", Value: "Main"}}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+		err  bool
+	}{
+		{
+			name: "no where clause",
+			sql:  `SELECT page, COUNT(*) FROM wiki GROUP BY page`,
+			want: `SELECT page, COUNT(*) FROM wiki WHERE "page" = 'Main' GROUP BY page`,
+		},
+		{
+			name: "no clause",
+			sql:  `SELECT page FROM wiki;`,
+			want: `SELECT page FROM wiki WHERE "page" = 'Main'`,
+		},
+		{
+			name: "where clause",
+			sql:  `SELECT page FROM wiki WHERE isRobot = 'false' OR isNew = 'true' LIMIT 10`,
+			want: `SELECT page FROM wiki WHERE "page" = 'Main' AND (isRobot = 'false' OR isNew = 'true') LIMIT 10`,
+		},
+		{
+			name: "sub query",
+			sql:  `SELECT page FROM (SELECT page FROM wiki WHERE isRobot = 'false') ORDER BY page`,
+			want: `SELECT page FROM (SELECT page FROM wiki WHERE isRobot = 'false') WHERE "page" = 'Main' ORDER BY page`,
+		},
+		{
+			name: "keywords in literals",
+			sql:  `SELECT 'WHERE' AS "LIMIT" FROM wiki`,
+			want: `SELECT 'WHERE' AS "LIMIT" FROM wiki WHERE "page" = 'Main'`,
+		},
+		{
+			name: "line comments",
+			sql:  "SELECT page -- WHERE x = 1\nFROM wiki -- LIMIT 10",
+			want: "SELECT page \nFROM wiki WHERE \"page\" = 'Main'",
+		},
+		{
+			name: "block comments",
+			sql:  `SELECT page /* GROUP BY */ FROM wiki /* ORDER BY page */ LIMIT 10`,
+			want: `SELECT page   FROM wiki WHERE "page" = 'Main' LIMIT 10`,
+		},
+		{
+			name: "comment markers in literals",
+			sql:  `SELECT '--' AS "/*" FROM wiki`,
+			want: `SELECT '--' AS "/*" FROM wiki WHERE "page" = 'Main'`,
+		},
+		{
+			name: "union",
+			sql:  `SELECT page FROM wiki WHERE isRobot = 'true' UNION ALL SELECT page FROM wiki`,
+			err:  true,
+		},
+		{
+			name: "union of sub queries",
+			sql:  `(SELECT page FROM wiki) UNION ALL (SELECT page FROM wiki)`,
+			err:  true,
+		},
+		{
+			name: "union in a sub query",
+			sql:  `SELECT page FROM (SELECT page FROM wiki UNION ALL SELECT page FROM wiki)`,
+			want: `SELECT page FROM (SELECT page FROM wiki UNION ALL SELECT page FROM wiki) WHERE "page" = 'Main'`,
+		},
+		{
+			name: "except",
+			sql:  `SELECT page FROM wiki EXCEPT SELECT page FROM wiki WHERE isRobot = 'true'`,
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqlWithAdhocFilters(tt.sql, filters)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSQLAdhocFilter(t *testing.T) {
+	tests := []struct {
+		filter adhocFilter
+		want   string
+	}{
+		{adhocFilter{Key: "page", Operator: "=", Value: "O'Neil"}, `"page" = 'O''Neil'`},
+		{adhocFilter{Key: "page", Operator: "!=", Value: "Main"}, `"page" <> 'Main'`},
+		{adhocFilter{Key: "page", Operator: "=~", Value: "^M"}, `REGEXP_LIKE("page", '^M')`},
+		{adhocFilter{Key: "page", Operator: "!~", Value: "^M"}, `NOT REGEXP_LIKE("page", '^M')`},
+		{adhocFilter{Key: "edits", Operator: "<", Value: "10"}, `"edits" < 10`},
+		{adhocFilter{Key: "page", Operator: ">", Value: "M"}, `"page" > 'M'`},
+		{adhocFilter{Key: `a"b`, Operator: "=", Value: "c"}, `"a""b" = 'c'`},
+	}
+	for _, tt := range tests {
+		got, err := sqlAdhocFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+	if _, err := sqlAdhocFilter(adhocFilter{Key: "page", Operator: "<>", Value: "Main"}); err == nil {
+		t.Error("expected an error for an unsupported operator")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+)
+
+// Ways to render array values (multi-value dimensions, SQL arrays...)
+const (
+	arrayHandlingJSON    = "json"
+	arrayHandlingJoin    = "join"
+	arrayHandlingExplode = "explode"
+)
+
+const defaultArraySeparator = ", "
+
+// prepareArrays renders the array values of a response either as JSON strings,
+// as strings made of the joined elements or by exploding rows, one per element.
+func prepareArrays(resp *druidResponse, mode string, separator string) {
+	arrayColumns := make(map[int]bool)
+	for _, r := range resp.Rows {
+		for ic := range resp.Columns {
+			if _, ok := r[ic].([]interface{}); ok {
+				arrayColumns[ic] = true
+			}
+		}
+	}
+	if len(arrayColumns) == 0 {
+		return
+	}
+	switch mode {
+	case arrayHandlingExplode:
+		var rows [][]interface{}
+		for _, r := range resp.Rows {
+			rows = append(rows, explodeRow(r)...)
+		}
+		resp.Rows = rows
+		for ic := range arrayColumns {
+			if resp.Columns[ic].Type != "string" {
+				detectColumnType(&resp.Columns[ic], ic, resp.Rows)
+			}
+		}
+		return
+	case arrayHandlingJoin:
+		for _, r := range resp.Rows {
+			for ic := range arrayColumns {
+				if a, ok := r[ic].([]interface{}); ok {
+					elements := make([]string, len(a))
+					for i, e := range a {
+						elements[i] = toJSONString(e)
+					}
+					r[ic] = strings.Join(elements, separator)
+				}
+			}
+		}
+	default:
+		for _, r := range resp.Rows {
+			for ic := range arrayColumns {
+				if _, ok := r[ic].([]interface{}); ok {
+					r[ic] = toJSONString(r[ic])
+				}
+			}
+		}
+	}
+	for ic := range arrayColumns {
+		if resp.Columns[ic].Type != "json" {
+			resp.Columns[ic].Type = "string"
+		}
+	}
+}
+
+// explodeRow returns one row per combination of the elements of the row
+// arrays, the same way Druid groups on multi-value dimensions.
+// Empty arrays are considered as null.
+func explodeRow(row []interface{}) [][]interface{} {
+	rows := [][]interface{}{make([]interface{}, 0, len(row))}
+	for _, v := range row {
+		a, ok := v.([]interface{})
+		if !ok || len(a) == 0 {
+			if ok {
+				v = nil
+			}
+			for i := range rows {
+				rows[i] = append(rows[i], v)
+			}
+			continue
+		}
+		exploded := make([][]interface{}, 0, len(rows)*len(a))
+		for _, r := range rows {
+			for _, e := range a {
+				nr := make([]interface{}, len(r), len(row))
+				copy(nr, r)
+				exploded = append(exploded, append(nr, e))
+			}
+		}
+		rows = exploded
+	}
+	return rows
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPrepareArrays(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		separator string
+		columns   []druidColumn
+		rows      [][]interface{}
+		wantTypes []string
+		wantRows  [][]interface{}
+	}{
+		{
+			name:      "multi-value dimension as json",
+			mode:      arrayHandlingJSON,
+			columns:   []druidColumn{{Name: "tags", Type: "string"}, {Name: "count", Type: "int"}},
+			rows:      [][]interface{}{{[]interface{}{"a", "b"}, json.Number("1")}, {"c", json.Number("2")}},
+			wantTypes: []string{"string", "int"},
+			wantRows:  [][]interface{}{{`["a","b"]`, json.Number("1")}, {"c", json.Number("2")}},
+		},
+		{
+			name:      "json by default",
+			columns:   []druidColumn{{Name: "tags", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{"a", "b"}}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{`["a","b"]`}},
+		},
+		{
+			name:      "sql array as json",
+			mode:      arrayHandlingJSON,
+			columns:   []druidColumn{{Name: "ids", Type: "json"}},
+			rows:      [][]interface{}{{[]interface{}{json.Number("1"), json.Number("2")}}},
+			wantTypes: []string{"json"},
+			wantRows:  [][]interface{}{{`[1,2]`}},
+		},
+		{
+			name:      "multi-value dimension joined",
+			mode:      arrayHandlingJoin,
+			separator: ", ",
+			columns:   []druidColumn{{Name: "tags", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{"a", "b"}}, {"c"}, {nil}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{"a, b"}, {"c"}, {nil}},
+		},
+		{
+			name:      "sql array joined with a custom separator",
+			mode:      arrayHandlingJoin,
+			separator: "|",
+			columns:   []druidColumn{{Name: "ids", Type: "json"}},
+			rows:      [][]interface{}{{[]interface{}{json.Number("1"), json.Number("2")}}},
+			wantTypes: []string{"json"},
+			wantRows:  [][]interface{}{{"1|2"}},
+		},
+		{
+			name:      "null elements joined",
+			mode:      arrayHandlingJoin,
+			separator: ",",
+			columns:   []druidColumn{{Name: "tags", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{"a", nil, "b"}}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{"a,,b"}},
+		},
+		{
+			name:      "empty array joined",
+			mode:      arrayHandlingJoin,
+			separator: ",",
+			columns:   []druidColumn{{Name: "tags", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{}}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{""}},
+		},
+		{
+			name:      "null elements and empty array as json",
+			mode:      arrayHandlingJSON,
+			columns:   []druidColumn{{Name: "tags", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{"a", nil}}, {[]interface{}{}}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{`["a",null]`}, {`[]`}},
+		},
+		{
+			name:      "multi-value dimension exploded",
+			mode:      arrayHandlingExplode,
+			columns:   []druidColumn{{Name: "tags", Type: "string"}, {Name: "count", Type: "int"}},
+			rows:      [][]interface{}{{[]interface{}{"a", "b"}, json.Number("1")}, {"c", json.Number("2")}},
+			wantTypes: []string{"string", "int"},
+			wantRows:  [][]interface{}{{"a", json.Number("1")}, {"b", json.Number("1")}, {"c", json.Number("2")}},
+		},
+		{
+			name:      "sql array exploded",
+			mode:      arrayHandlingExplode,
+			columns:   []druidColumn{{Name: "ids", Type: "json"}},
+			rows:      [][]interface{}{{[]interface{}{json.Number("1"), json.Number("2")}}},
+			wantTypes: []string{"int"},
+			wantRows:  [][]interface{}{{json.Number("1")}, {json.Number("2")}},
+		},
+		{
+			name:      "null elements and empty array exploded",
+			mode:      arrayHandlingExplode,
+			columns:   []druidColumn{{Name: "tags", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{"a", nil}}, {[]interface{}{}}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{"a"}, {nil}, {nil}},
+		},
+		{
+			name:      "arrays exploded into their combinations",
+			mode:      arrayHandlingExplode,
+			columns:   []druidColumn{{Name: "tags", Type: "string"}, {Name: "users", Type: "string"}},
+			rows:      [][]interface{}{{[]interface{}{"a", "b"}, []interface{}{"x", "y"}}},
+			wantTypes: []string{"string", "string"},
+			wantRows:  [][]interface{}{{"a", "x"}, {"a", "y"}, {"b", "x"}, {"b", "y"}},
+		},
+		{
+			name:      "no arrays",
+			mode:      arrayHandlingExplode,
+			columns:   []druidColumn{{Name: "page", Type: "string"}},
+			rows:      [][]interface{}{{"a"}, {nil}},
+			wantTypes: []string{"string"},
+			wantRows:  [][]interface{}{{"a"}, {nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &druidResponse{Columns: tt.columns, Rows: tt.rows}
+			prepareArrays(resp, tt.mode, tt.separator)
+			for i, c := range resp.Columns {
+				if c.Type != tt.wantTypes[i] {
+					t.Errorf("column %s: expected type %s, got %s", c.Name, tt.wantTypes[i], c.Type)
+				}
+			}
+			if !reflect.DeepEqual(resp.Rows, tt.wantRows) {
+				t.Errorf("expected rows %v, got %v", tt.wantRows, resp.Rows)
+			}
+		})
+	}
+}
+
+func TestPrepareResponseArraySettings(t *testing.T) {
+	tests := []struct {
+		settings map[string]interface{}
+		want     []string
+	}{
+		{map[string]interface{}{}, []string{`["a","b"]`}},
+		{map[string]interface{}{"arrayHandling": "join"}, []string{"a, b"}},
+		{map[string]interface{}{"arrayHandling": "join", "arraySeparator": " / "}, []string{"a / b"}},
+		{map[string]interface{}{"arrayHandling": "explode"}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		resp := &druidResponse{
+			Columns: []druidColumn{{Name: "tags", Type: "string"}},
+			Rows:    [][]interface{}{{[]interface{}{"a", "b"}}},
+		}
+		r, err := (&druidDatasource{}).prepareResponse(resp, tt.settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := r.Frames[0].Fields[0]
+		if f.Len() != len(tt.want) {
+			t.Fatalf("%v: expected %d rows, got %d", tt.settings, len(tt.want), f.Len())
+		}
+		for i, w := range tt.want {
+			if v, ok := f.ConcreteAt(i); !ok || v != w {
+				t.Errorf("%v: row %d: expected %s, got %v", tt.settings, i, w, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+)
+
+// Default maximum size of the query cache, in megabytes
+const defaultQueryCacheMaxSize = 10
+
+// queryCache is a least recently used cache of Druid query results, bounded
+// in size and whose entries expire after a time to live.
+type queryCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	size    int
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+type queryCacheEntry struct {
+	key       string
+	value     json.RawMessage
+	expiresAt time.Time
+}
+
+func newQueryCache(ttl time.Duration, maxSize int) *queryCache {
+	return &queryCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+func (c *queryCache) get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*queryCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(e)
+		return nil, false
+	}
+	c.entries.MoveToFront(e)
+	return entry.value, true
+}
+
+func (c *queryCache) set(key string, value json.RawMessage) {
+	if len(key)+len(value) > c.maxSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.index[key]; ok {
+		c.remove(e)
+	}
+	entry := &queryCacheEntry{key: key, value: value, expiresAt: time.Now().Add(c.ttl)}
+	c.index[key] = c.entries.PushFront(entry)
+	c.size += entry.size()
+	for c.size > c.maxSize {
+		c.remove(c.entries.Back())
+	}
+}
+
+func (c *queryCache) remove(e *list.Element) {
+	entry := c.entries.Remove(e).(*queryCacheEntry)
+	delete(c.index, entry.key)
+	c.size -= entry.size()
+}
+
+// size is the memory an entry takes, its key included.
+func (e *queryCacheEntry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+// queryCacheKey identifies a query by its Druid JSON, query identifiers aside,
+// and the settings its response is prepared with.
+func queryCacheKey(q druidquerybuilder.Query, settings map[string]interface{}) (string, error) {
+	key, err := queryFingerprint(q)
+	if err != nil {
+		return "", err
+	}
+	stg, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(key))
+	h.Write(stg)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// queryFingerprint serializes a query without the identifiers generated for each execution.
+func queryFingerprint(q druidquerybuilder.Query) (string, error) {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	var query map[string]interface{}
+	if err := json.Unmarshal(b, &query); err != nil {
+		return "", err
+	}
+	if ctx, ok := query["context"].(map[string]interface{}); ok {
+		delete(ctx, "queryId")
+		delete(ctx, "sqlQueryId")
+	}
+	b, err = json.Marshal(query)
+	return string(b), err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestQueryCacheSizeCountsKeys(t *testing.T) {
+	c := newQueryCache(time.Minute, 20)
+	c.set("key1", json.RawMessage("123456"))
+	c.set("key2", json.RawMessage("123456"))
+	if c.size != 20 {
+		t.Fatalf("expected a size of 20, got %d", c.size)
+	}
+	// the least recently used entry is evicted
+	c.get("key1")
+	c.set("key3", json.RawMessage("1"))
+	if _, ok := c.get("key2"); ok {
+		t.Error("expected key2 to be evicted")
+	}
+	if _, ok := c.get("key1"); !ok {
+		t.Error("expected key1 to be kept")
+	}
+	if c.size != 15 {
+		t.Errorf("expected a size of 15, got %d", c.size)
+	}
+	// too large once its key is counted
+	c.set("key4", json.RawMessage("12345678901234567"))
+	if _, ok := c.get("key4"); ok {
+		t.Error("expected key4 not to be cached")
+	}
+}
+
+func TestQueryCacheExpiry(t *testing.T) {
+	c := newQueryCache(time.Millisecond, 100)
+	c.set("key", json.RawMessage("1"))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.get("key"); ok {
+		t.Error("expected the entry to be expired")
+	}
+	if c.size != 0 {
+		t.Errorf("expected a size of 0, got %d", c.size)
+	}
+}
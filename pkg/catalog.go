@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druiddatasource "github.com/grafadruid/go-druid/builder/datasource"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	// How long the columns types of a Druid datasource are trusted before being fetched again
+	columnCatalogTTL = 5 * time.Minute
+	// How long Druid failing to tell the columns of a datasource is trusted before trying again
+	columnCatalogFailureTTL = 30 * time.Second
+)
+
+// columnCatalog caches the columns types of Druid datasources, per identity
+// forwarded to Druid.
+type columnCatalog struct {
+	mu     sync.Mutex
+	tables map[string]columnCatalogEntry
+	// concurrent fetches of a same datasource share the same Druid queries
+	inflight *inflightGroup
+}
+
+// columnCatalogEntry holds the columns types of a datasource, nil when Druid couldn't tell them.
+type columnCatalogEntry struct {
+	columns   map[string]string
+	fetchedAt time.Time
+}
+
+func (e columnCatalogEntry) fresh() bool {
+	ttl := columnCatalogTTL
+	if e.columns == nil {
+		ttl = columnCatalogFailureTTL
+	}
+	return time.Since(e.fetchedAt) < ttl
+}
+
+func newColumnCatalog() *columnCatalog {
+	return &columnCatalog{
+		tables:   make(map[string]columnCatalogEntry),
+		inflight: newInflightGroup(),
+	}
+}
+
+// columnTypes returns the columns types of the given datasource, fetching them
+// from Druid when unknown or outdated. A nil map is returned when Druid can't tell.
+func (c *columnCatalog) columnTypes(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings, table string) map[string]string {
+	// users identified to Druid may not be allowed the same datasources
+	key := table + identityKey(ctx)
+	c.mu.Lock()
+	entry, ok := c.tables[key]
+	c.mu.Unlock()
+	if ok && entry.fresh() {
+		return entry.columns
+	}
+	v, err := c.inflight.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		columns, err := fetchColumns(ctx, ds, s, table)
+		if err != nil && ctx.Err() != nil {
+			// nobody waits for the columns anymore, which says nothing about Druid
+			return nil, err
+		}
+		c.mu.Lock()
+		c.tables[key] = columnCatalogEntry{columns: columns, fetchedAt: time.Now()}
+		c.mu.Unlock()
+		return columns, err
+	})
+	if err != nil {
+		return nil
+	}
+	// the columns are shared with the other callers and the catalog, read only
+	columns, _ := v.(map[string]string)
+	return columns
+}
+
+func fetchColumns(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings, table string) (map[string]string, error) {
+	columns, err := fetchInformationSchemaColumns(ctx, ds, s, table)
+	if err != nil {
+		log.DefaultLogger.Debug("DRUID COLUMN CATALOG", "table", table, "information_schema_error", err)
+		columns, err = fetchSegmentMetadataColumns(ctx, ds, s, table)
+	}
+	if err != nil {
+		log.DefaultLogger.Warn("DRUID COLUMN CATALOG", "table", table, "error", err)
+		return nil, err
+	}
+	return columns, nil
+}
+
+func fetchInformationSchemaColumns(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings, table string) (map[string]string, error) {
+	q := druidquery.NewSQL().
+		SetQuery(`SELECT "COLUMN_NAME", "DATA_TYPE" FROM INFORMATION_SCHEMA.COLUMNS WHERE "TABLE_SCHEMA" = 'druid' AND "TABLE_NAME" = ?`).
+		SetParameters([]druidquery.SQLParameter{{Type: "VARCHAR", Value: table}}).
+		SetResultFormat("array")
+	var rows [][]interface{}
+	if err := ds.runQuery(ctx, q, s, &rows); err != nil {
+		return nil, err
+	}
+	columns := make(map[string]string)
+	for _, row := range rows {
+		if len(row) != 2 {
+			continue
+		}
+		name, _ := row[0].(string)
+		if t := sqlColumnType(row[1]); name != "" && t != "" {
+			columns[name] = t
+		}
+	}
+	if len(columns) == 0 {
+		// e.g. INFORMATION_SCHEMA doesn't list the table yet
+		return nil, fmt.Errorf("no columns listed in INFORMATION_SCHEMA for %s", table)
+	}
+	return columns, nil
+}
+
+func fetchSegmentMetadataColumns(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings, table string) (map[string]string, error) {
+	q := druidquery.NewSegmentMetadata().
+		SetDataSource(druiddatasource.NewTable().SetName(table)).
+		SetMerge(true).
+		SetAnalysisTypes([]druidquery.AnalysisType{druidquery.Interval})
+	var result []struct {
+		Columns map[string]struct {
+			Type string `json:"type"`
+		} `json:"columns"`
+	}
+	if err := ds.runQuery(ctx, q, s, &result); err != nil {
+		return nil, err
+	}
+	columns := make(map[string]string)
+	for _, r := range result {
+		for name, c := range r.Columns {
+			if t := nativeColumnType(c.Type); t != "" {
+				columns[name] = t
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns in the segments of %s", table)
+	}
+	if _, ok := columns["__time"]; ok {
+		columns["__time"] = "time"
+	}
+	return columns, nil
+}
+
+// queryTable returns the name of the table a native query reads, empty for
+// other kinds of datasources (joins, inline, sub queries...).
+func queryTable(q druidquerybuilder.Query) string {
+	base := queryBase(q)
+	if base == nil {
+		return ""
+	}
+	t, ok := base.DataSource.(*druiddatasource.Table)
+	if !ok {
+		return ""
+	}
+	return t.Name
+}
+
+// applyColumnTypes types the columns of a native query response using the
+// outputs declared in the query, then the datasource schema. Columns
+// unknown to both keep their detected type.
+func (ds *druidDatasource) applyColumnTypes(ctx context.Context, q druidquerybuilder.Query, r *druidResponse, s *druidInstanceSettings, outputs map[string]string) {
+	var columns map[string]string
+	if table := queryTable(q); table != "" && s.catalog != nil {
+		columns = s.catalog.columnTypes(ctx, ds, s, table)
+	}
+	for i, c := range r.Columns {
+		if t, ok := outputs[c.Name]; ok {
+			r.Columns[i].Type = t
+		} else if t, ok := columns[c.Name]; ok {
+			r.Columns[i].Type = t
+		} else if c.Name == "timestamp" || c.Name == "__time" {
+			r.Columns[i].Type = "time"
+		}
+	}
+}
+
+// queryOutputTypes derives the types of the columns a native query computes
+// (aggregations, post aggregations, dimensions and virtual columns) from its definition.
+func queryOutputTypes(q druidquerybuilder.Query) map[string]string {
+	types := make(map[string]string)
+	var query map[string]interface{}
+	b, err := json.Marshal(q)
+	if err != nil || json.Unmarshal(b, &query) != nil {
+		return types
+	}
+	if vcs, ok := query["virtualColumns"].([]interface{}); ok {
+		for _, vc := range vcs {
+			v, _ := vc.(map[string]interface{})
+			name, _ := v["name"].(string)
+			outputType, ok := v["outputType"].(string)
+			if !ok {
+				// expression virtual columns default to FLOAT
+				outputType = "FLOAT"
+			}
+			if t := nativeColumnType(outputType); name != "" && t != "" {
+				types[name] = t
+			}
+		}
+	}
+	dimensions, _ := query["dimensions"].([]interface{})
+	if dimension, ok := query["dimension"]; ok {
+		dimensions = append(dimensions, dimension)
+	}
+	for _, dimension := range dimensions {
+		switch d := dimension.(type) {
+		case string:
+			types[d] = "string"
+		case map[string]interface{}:
+			name, _ := d["outputName"].(string)
+			if name == "" {
+				name, _ = d["dimension"].(string)
+			}
+			t := "string"
+			if outputType, ok := d["outputType"].(string); ok && nativeColumnType(outputType) != "" {
+				t = nativeColumnType(outputType)
+			}
+			if name != "" {
+				types[name] = t
+			}
+		}
+	}
+	if aggregations, ok := query["aggregations"].([]interface{}); ok {
+		for _, aggregation := range aggregations {
+			a, _ := aggregation.(map[string]interface{})
+			if name, t := aggregatorType(a); name != "" && t != "" {
+				types[name] = t
+			}
+		}
+	}
+	if postAggregations, ok := query["postAggregations"].([]interface{}); ok {
+		for _, postAggregation := range postAggregations {
+			p, _ := postAggregation.(map[string]interface{})
+			if name, t := postAggregatorType(p, types); name != "" && t != "" {
+				types[name] = t
+			}
+		}
+	}
+	return types
+}
+
+func aggregatorType(a map[string]interface{}) (string, string) {
+	name, _ := a["name"].(string)
+	typ, _ := a["type"].(string)
+	switch typ {
+	case "count", "longSum", "longMin", "longMax", "longFirst", "longLast", "longAny":
+		return name, "int"
+	case "doubleSum", "doubleMin", "doubleMax", "doubleFirst", "doubleLast", "doubleAny", "doubleMean",
+		"floatSum", "floatMin", "floatMax", "floatFirst", "floatLast", "floatAny",
+		"cardinality", "hyperUnique", "thetaSketch", "HLLSketchBuild", "HLLSketchMerge":
+		return name, "float"
+	case "stringFirst", "stringLast", "stringAny", "stringFirstFold", "stringLastFold":
+		return name, "string"
+	case "filtered":
+		inner, _ := a["aggregator"].(map[string]interface{})
+		innerName, t := aggregatorType(inner)
+		if name == "" {
+			name = innerName
+		}
+		return name, t
+	}
+	return name, ""
+}
+
+func postAggregatorType(p map[string]interface{}, types map[string]string) (string, string) {
+	name, _ := p["name"].(string)
+	typ, _ := p["type"].(string)
+	switch typ {
+	case "arithmetic", "constant", "doubleGreatest", "doubleLeast", "hyperUniqueCardinality",
+		"thetaSketchEstimate", "HLLSketchEstimate", "quantilesDoublesSketchToQuantile",
+		"quantilesDoublesSketchToRank", "quantileFromTDigestSketch":
+		return name, "float"
+	case "longGreatest", "longLeast":
+		return name, "int"
+	case "quantilesDoublesSketchToString":
+		return name, "string"
+	case "fieldAccess", "finalizingFieldAccess":
+		fieldName, _ := p["fieldName"].(string)
+		return name, types[fieldName]
+	case "expression":
+		outputType, _ := p["outputType"].(string)
+		return name, nativeColumnType(outputType)
+	}
+	return name, ""
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafadruid/go-druid"
+)
+
+// newTestCatalogSettings returns settings querying a fake Druid answering with the given handler.
+func newTestCatalogSettings(t *testing.T, handler http.HandlerFunc) *druidInstanceSettings {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := druid.NewClient(server.URL, druid.WithRetryMax(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &druidInstanceSettings{client: c, catalog: newColumnCatalog()}
+}
+
+func TestColumnTypesDeduplicatesColdFetches(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[["__time","TIMESTAMP"],["page","VARCHAR"],["edits","BIGINT"]]`))
+	})
+	ds := &druidDatasource{}
+
+	var wg sync.WaitGroup
+	results := make([]map[string]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = s.catalog.columnTypes(context.Background(), ds, s, "wiki")
+		}(i)
+	}
+	// let every caller join the fetch before Druid answers
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected 1 request to Druid, got %d", n)
+	}
+	for _, columns := range results {
+		if columns["page"] != "string" || columns["__time"] != "time" {
+			t.Fatalf("unexpected columns %v", columns)
+		}
+	}
+	s.catalog.columnTypes(context.Background(), ds, s, "wiki")
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected the columns to be cached, got %d requests", n)
+	}
+}
+
+func TestColumnTypesCachesFailures(t *testing.T) {
+	var requests int32
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Unknown exception"}`))
+	})
+	ds := &druidDatasource{}
+
+	if columns := s.catalog.columnTypes(context.Background(), ds, s, "wiki"); columns != nil {
+		t.Fatalf("expected no columns, got %v", columns)
+	}
+	// information schema, then segment metadata
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected 2 requests to Druid, got %d", n)
+	}
+	if columns := s.catalog.columnTypes(context.Background(), ds, s, "wiki"); columns != nil {
+		t.Fatalf("expected no columns, got %v", columns)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected the failure to be cached, got %d requests", n)
+	}
+
+	// the failure expires sooner than columns
+	s.catalog.mu.Lock()
+	entry := s.catalog.tables["wiki"]
+	entry.fetchedAt = entry.fetchedAt.Add(-columnCatalogFailureTTL)
+	s.catalog.tables["wiki"] = entry
+	s.catalog.mu.Unlock()
+	s.catalog.columnTypes(context.Background(), ds, s, "wiki")
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Fatalf("expected the columns to be fetched again, got %d requests", n)
+	}
+}
+
+func TestColumnTypesPerIdentity(t *testing.T) {
+	var requests int32
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[["page","VARCHAR"]]`))
+	})
+	ds := &druidDatasource{}
+	alice := withForwardedHeaders(context.Background(), http.Header{authorizationHeader: {"Bearer alice"}})
+	bob := withForwardedHeaders(context.Background(), http.Header{authorizationHeader: {"Bearer bob"}})
+
+	s.catalog.columnTypes(alice, ds, s, "wiki")
+	s.catalog.columnTypes(alice, ds, s, "wiki")
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected 1 request to Druid, got %d", n)
+	}
+	s.catalog.columnTypes(bob, ds, s, "wiki")
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected the columns to be fetched for each identity, got %d requests", n)
+	}
+}
+
+func TestColumnTypesFallsBackWhenTableNotListed(t *testing.T) {
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/druid/v2/sql" {
+			// INFORMATION_SCHEMA doesn't list the table
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"columns":{"__time":{"type":"LONG"},"page":{"type":"STRING"},"edits":{"type":"LONG"}}}]`))
+	})
+	columns := s.catalog.columnTypes(context.Background(), &druidDatasource{}, s, "wiki")
+	if columns["page"] != "string" || columns["__time"] != "time" || columns["edits"] != "int" {
+		t.Errorf("expected the columns of the segments, got %v", columns)
+	}
+}
+
+func TestColumnTypesDoesntCacheEmptyColumnsAsSuccess(t *testing.T) {
+	var requests int32
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+	if columns := s.catalog.columnTypes(context.Background(), &druidDatasource{}, s, "wiki"); columns != nil {
+		t.Fatalf("expected no columns, got %v", columns)
+	}
+	s.catalog.mu.Lock()
+	entry := s.catalog.tables["wiki"]
+	s.catalog.mu.Unlock()
+	if entry.columns != nil || !entry.fresh() {
+		t.Errorf("expected a failure to be cached, got %+v", entry)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected both INFORMATION_SCHEMA and segment metadata to be queried, got %d requests", n)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+)
+
+// complexExpansion turns a column holding complex values (sketches results,
+// histograms...) into several numeric columns, suffixed by names.
+type complexExpansion struct {
+	names  []string
+	values func(v interface{}) []interface{}
+}
+
+// complexExpansions returns the expansions of the post aggregations of a native
+// query which results are arrays whose meaning is only known from the query.
+func complexExpansions(q druidquerybuilder.Query) map[string]complexExpansion {
+	expansions := make(map[string]complexExpansion)
+	var query map[string]interface{}
+	b, err := json.Marshal(q)
+	if err != nil || json.Unmarshal(b, &query) != nil {
+		return expansions
+	}
+	postAggregations, _ := query["postAggregations"].([]interface{})
+	for _, postAggregation := range postAggregations {
+		p, _ := postAggregation.(map[string]interface{})
+		name, _ := p["name"].(string)
+		typ, _ := p["type"].(string)
+		switch typ {
+		case "quantilesDoublesSketchToQuantiles":
+			fractions, _ := p["fractions"].([]interface{})
+			var names []string
+			for _, f := range fractions {
+				names = append(names, percentileName(f))
+			}
+			expansions[name] = complexExpansion{names: names, values: arrayValues}
+		case "quantilesDoublesSketchToHistogram":
+			splitPoints, _ := p["splitPoints"].([]interface{})
+			if len(splitPoints) == 0 {
+				// the bins are only known when the histogram is returned
+				continue
+			}
+			breaks := append([]interface{}{math.Inf(-1)}, splitPoints...)
+			breaks = append(breaks, math.Inf(1))
+			expansions[name] = complexExpansion{names: binNames(breaks), values: arrayValues}
+		case "HLLSketchEstimateWithBounds":
+			expansions[name] = complexExpansion{names: []string{"estimate", "lowerBound", "upperBound"}, values: arrayValues}
+		}
+	}
+	return expansions
+}
+
+// objectExpansion guesses the expansion of complex values returned as JSON objects.
+func objectExpansion(o map[string]interface{}) (complexExpansion, bool) {
+	if probabilities, ok := o["probabilities"].([]interface{}); ok {
+		// approximate histogram quantiles
+		var names []string
+		for _, p := range probabilities {
+			names = append(names, percentileName(p))
+		}
+		names = append(names, "min", "max")
+		return complexExpansion{names: names, values: func(v interface{}) []interface{} {
+			vo, _ := v.(map[string]interface{})
+			values := arrayValues(vo["quantiles"])
+			return append(values, vo["min"], vo["max"])
+		}}, true
+	}
+	if breaks, ok := o["breaks"].([]interface{}); ok {
+		// approximate histogram
+		return complexExpansion{names: binNames(breaks), values: func(v interface{}) []interface{} {
+			vo, _ := v.(map[string]interface{})
+			return arrayValues(vo["counts"])
+		}}, true
+	}
+	if _, ok := o["estimate"]; ok {
+		// sketch estimate with bounds
+		var keys []string
+		for k := range o {
+			if _, ok := o[k].(json.Number); ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			switch k {
+			case "lowBound":
+				names[i] = "lowerBound"
+			case "highBound":
+				names[i] = "upperBound"
+			default:
+				names[i] = k
+			}
+		}
+		return complexExpansion{names: names, values: func(v interface{}) []interface{} {
+			vo, _ := v.(map[string]interface{})
+			values := make([]interface{}, len(keys))
+			for i, k := range keys {
+				values[i] = vo[k]
+			}
+			return values
+		}}, true
+	}
+	return complexExpansion{}, false
+}
+
+// expandComplexColumns replaces the columns holding complex values by their numeric counterparts.
+func expandComplexColumns(r *druidResponse, expansions map[string]complexExpansion) {
+	var columns []druidColumn
+	var columnExpansions []*complexExpansion
+	for ic, c := range r.Columns {
+		e, ok := expansions[c.Name]
+		if !ok {
+			for _, row := range r.Rows {
+				if o, isObject := row[ic].(map[string]interface{}); isObject {
+					e, ok = objectExpansion(o)
+					break
+				}
+			}
+		}
+		if !ok || len(e.names) == 0 {
+			columns = append(columns, c)
+			columnExpansions = append(columnExpansions, nil)
+			continue
+		}
+		for _, n := range e.names {
+			columns = append(columns, druidColumn{Name: c.Name + "_" + n, Type: "float"})
+		}
+		expansion := e
+		columnExpansions = append(columnExpansions, &expansion)
+	}
+	if len(columns) == len(r.Columns) {
+		return
+	}
+	for ir, row := range r.Rows {
+		expanded := make([]interface{}, 0, len(columns))
+		for ic, v := range row {
+			e := columnExpansions[ic]
+			if e == nil {
+				expanded = append(expanded, v)
+				continue
+			}
+			values := make([]interface{}, len(e.names))
+			if v != nil {
+				copy(values, e.values(v))
+			}
+			expanded = append(expanded, values...)
+		}
+		r.Rows[ir] = expanded
+	}
+	r.Columns = columns
+}
+
+func arrayValues(v interface{}) []interface{} {
+	a, _ := v.([]interface{})
+	return a
+}
+
+// percentileName names a quantile fraction, e.g: 0.95 is p95.
+func percentileName(fraction interface{}) string {
+	f := toFloat64(fraction)
+	return "p" + strconv.FormatFloat(math.Round(f*1e6)/1e4, 'f', -1, 64)
+}
+
+// binNames names the bins delimited by the given breaks.
+func binNames(breaks []interface{}) []string {
+	var names []string
+	for i := 0; i < len(breaks)-1; i++ {
+		names = append(names, "bin_"+formatBreak(breaks[i])+"_"+formatBreak(breaks[i+1]))
+	}
+	return names
+}
+
+func formatBreak(b interface{}) string {
+	f, ok := b.(float64)
+	if !ok {
+		f = toFloat64(b)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
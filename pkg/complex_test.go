@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+)
+
+// rawTestQuery is a query sent as is, for the post aggregations the query
+// builder can't load.
+type rawTestQuery string
+
+func (q rawTestQuery) Type() druidquerybuilder.ComponentType {
+	return "groupBy"
+}
+
+func (q rawTestQuery) MarshalJSON() ([]byte, error) {
+	return []byte(q), nil
+}
+
+func testColumnNames(r *druidResponse) []string {
+	var names []string
+	for _, c := range r.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestExpandHLLSketchEstimateWithBounds(t *testing.T) {
+	q := rawTestQuery(`{"queryType":"groupBy","postAggregations":[{"type":"HLLSketchEstimateWithBounds","name":"users","field":{"type":"fieldAccess","fieldName":"users_sketch"},"numStdDev":2}]}`)
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "page", Type: "string"}, {Name: "users", Type: "nil"}},
+		Rows: [][]interface{}{
+			{"Main", []interface{}{json.Number("10.5"), json.Number("9"), json.Number("12")}},
+			{"Other", nil},
+		},
+	}
+	expandComplexColumns(r, complexExpansions(q))
+	want := []string{"page", "users_estimate", "users_lowerBound", "users_upperBound"}
+	if names := testColumnNames(r); !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the columns %v, got %v", want, names)
+	}
+	if want := []interface{}{"Main", json.Number("10.5"), json.Number("9"), json.Number("12")}; !reflect.DeepEqual(r.Rows[0], want) {
+		t.Errorf("expected %v, got %v", want, r.Rows[0])
+	}
+	// a missing sketch gives null values
+	if want := []interface{}{"Other", nil, nil, nil}; !reflect.DeepEqual(r.Rows[1], want) {
+		t.Errorf("expected %v, got %v", want, r.Rows[1])
+	}
+}
+
+func TestExpandThetaSketchEstimateWithErrorBounds(t *testing.T) {
+	// thetaSketchEstimate with errorBoundsStdDev returns an object
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "users", Type: "nil"}},
+		Rows: [][]interface{}{
+			{map[string]interface{}{"estimate": json.Number("10"), "highBound": json.Number("12"), "lowBound": json.Number("8"), "numStdDev": json.Number("2")}},
+		},
+	}
+	expandComplexColumns(r, nil)
+	want := []string{"users_estimate", "users_upperBound", "users_lowerBound", "users_numStdDev"}
+	if names := testColumnNames(r); !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the columns %v, got %v", want, names)
+	}
+	if want := []interface{}{json.Number("10"), json.Number("12"), json.Number("8"), json.Number("2")}; !reflect.DeepEqual(r.Rows[0], want) {
+		t.Errorf("expected %v, got %v", want, r.Rows[0])
+	}
+}
+
+func TestExpandQuantilesDoublesSketchToQuantiles(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"groupBy","dataSource":{"type":"table","name":"wiki"},"granularity":"all",
+		"postAggregations":[{"type":"quantilesDoublesSketchToQuantiles","name":"latency","field":{"type":"fieldAccess","fieldName":"latency_sketch"},"fractions":[0.5,0.999]}]}`)
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "latency", Type: "nil"}},
+		Rows:    [][]interface{}{{[]interface{}{json.Number("120"), json.Number("950.5")}}},
+	}
+	expandComplexColumns(r, complexExpansions(q))
+	want := []string{"latency_p50", "latency_p99.9"}
+	if names := testColumnNames(r); !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the columns %v, got %v", want, names)
+	}
+	if want := []interface{}{json.Number("120"), json.Number("950.5")}; !reflect.DeepEqual(r.Rows[0], want) {
+		t.Errorf("expected %v, got %v", want, r.Rows[0])
+	}
+}
+
+func TestExpandQuantilesDoublesSketchToHistogram(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"groupBy","dataSource":{"type":"table","name":"wiki"},"granularity":"all",
+		"postAggregations":[{"type":"quantilesDoublesSketchToHistogram","name":"latency","field":{"type":"fieldAccess","fieldName":"latency_sketch"},"splitPoints":[100,500]}]}`)
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "latency", Type: "nil"}},
+		Rows:    [][]interface{}{{[]interface{}{json.Number("3"), json.Number("5"), json.Number("1")}}},
+	}
+	expandComplexColumns(r, complexExpansions(q))
+	want := []string{"latency_bin_-Inf_100", "latency_bin_100_500", "latency_bin_500_+Inf"}
+	if names := testColumnNames(r); !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the columns %v, got %v", want, names)
+	}
+}
+
+func TestExpandApproxHistogram(t *testing.T) {
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "page", Type: "string"}, {Name: "delta", Type: "nil"}},
+		Rows: [][]interface{}{
+			{"Main", map[string]interface{}{
+				"breaks": []interface{}{json.Number("-10"), json.Number("0"), json.Number("10.5")},
+				"counts": []interface{}{json.Number("4"), json.Number("6")},
+			}},
+		},
+	}
+	expandComplexColumns(r, nil)
+	want := []string{"page", "delta_bin_-10_0", "delta_bin_0_10.5"}
+	if names := testColumnNames(r); !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the columns %v, got %v", want, names)
+	}
+	if want := []interface{}{"Main", json.Number("4"), json.Number("6")}; !reflect.DeepEqual(r.Rows[0], want) {
+		t.Errorf("expected %v, got %v", want, r.Rows[0])
+	}
+}
+
+func TestExpandApproxHistogramQuantiles(t *testing.T) {
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "delta", Type: "nil"}},
+		Rows: [][]interface{}{
+			{map[string]interface{}{
+				"probabilities": []interface{}{json.Number("0.5"), json.Number("0.95")},
+				"quantiles":     []interface{}{json.Number("1.5"), json.Number("9")},
+				"min":           json.Number("0"),
+				"max":           json.Number("12"),
+			}},
+		},
+	}
+	expandComplexColumns(r, nil)
+	want := []string{"delta_p50", "delta_p95", "delta_min", "delta_max"}
+	if names := testColumnNames(r); !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected the columns %v, got %v", want, names)
+	}
+	if want := []interface{}{json.Number("1.5"), json.Number("9"), json.Number("0"), json.Number("12")}; !reflect.DeepEqual(r.Rows[0], want) {
+		t.Errorf("expected %v, got %v", want, r.Rows[0])
+	}
+}
+
+func TestExpandComplexColumnsLeavesOtherColumns(t *testing.T) {
+	r := &druidResponse{
+		Columns: []druidColumn{{Name: "page", Type: "string"}, {Name: "tags", Type: "nil"}},
+		Rows:    [][]interface{}{{"Main", map[string]interface{}{"a": "b"}}},
+	}
+	expandComplexColumns(r, nil)
+	if names := testColumnNames(r); !reflect.DeepEqual(names, []string{"page", "tags"}) {
+		t.Errorf("expected the columns to be kept, got %v", names)
+	}
+}
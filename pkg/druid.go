@@ -2,22 +2,23 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
-	"sort"
+	"net/url"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bitly/go-simplejson"
+	"github.com/google/uuid"
 	"github.com/grafadruid/go-druid"
 	druidquerybuilder "github.com/grafadruid/go-druid/builder"
-	druidquery "github.com/grafadruid/go-druid/builder/query"
+	"github.com/grafadruid/go-druid/builder/intervals"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
@@ -35,36 +36,61 @@ var (
 	varRateInterval = variableVariants("__rate_interval")
 )
 
+const (
+	// Maximum time given to Druid to acknowledge a query cancellation
+	queryCancelTimeout = 5 * time.Second
+	// Number of queries of a same request executed in parallel when not configured
+	defaultMaxConcurrentQueries = 10
+)
+
+// variableVariants returns the references to a variable. Replacing them
+// within JSON strings, quotes included, keeps the query JSON valid.
 func variableVariants(base string) []string {
 	return []string{
-		fmt.Sprintf(`"${%s}"`, base),
-		fmt.Sprintf(`"$%s"`, base),
-		fmt.Sprintf(`$%s`, base),
 		fmt.Sprintf(`${%s}`, base),
+		fmt.Sprintf(`$%s`, base),
 	}
 }
 
 type druidQuery struct {
-	Builder  map[string]interface{} `json:"builder"`
-	Settings map[string]interface{} `json:"settings"`
+	Builder      map[string]interface{} `json:"builder"`
+	Settings     map[string]interface{} `json:"settings"`
+	AdhocFilters []adhocFilter          `json:"adhocFilters"`
+}
+
+type druidColumn struct {
+	Name string
+	Type string
 }
 
 type druidResponse struct {
-	Reference string
-	Columns   []struct {
-		Name string
-		Type string
-	}
-	Rows [][]interface{}
+	Reference   string
+	Columns     []druidColumn
+	Rows        [][]interface{}
+	CacheStatus string
 }
 
 type druidInstanceSettings struct {
 	client               *druid.Client
+	httpClient           *http.Client
+	endpoints            *endpointPool
+	maxConcurrentQueries int
+	catalog              *columnCatalog
+	cache                *queryCache
+	bucketCache          *queryCache
+	inflight             *inflightGroup
+	identity             identityForwarding
 	defaultQuerySettings map[string]interface{}
 }
 
 func (s *druidInstanceSettings) Dispose() {
 	s.client.Close()
+	if s.endpoints != nil {
+		s.endpoints.close()
+		for _, e := range s.endpoints.endpoints {
+			e.client.Close()
+		}
+	}
 }
 
 func newDataSourceInstance(settings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
@@ -74,7 +100,44 @@ func newDataSourceInstance(settings backend.DataSourceInstanceSettings) (instanc
 	}
 	secureData := settings.DecryptedSecureJSONData
 
-	var druidOpts []druid.ClientOption
+	var authOpts []druid.ClientOption
+	if basicAuth := data.Get("connection.basicAuth").MustBool(); basicAuth {
+		authOpts = append(authOpts, druid.WithBasicAuth(data.Get("connection.basicAuthUser").MustString(), secureData["connection.basicAuthPassword"]))
+	}
+
+	transport, err := newTransport(data, secureData, settings.UID)
+	if err != nil {
+		return &druidInstanceSettings{}, err
+	}
+	headers := staticHeaders(data, secureData)
+	var roundTripper http.RoundTripper = transport
+
+	baseURL := data.Get("connection.url").MustString()
+	var endpoints *endpointPool
+	pool, err := newEndpointPool(append([]string{baseURL}, data.Get("connection.additionalUrls").MustStringArray()...), data.Get("connection.loadBalancing").MustString(priorityLoadBalancing))
+	if err != nil {
+		return &druidInstanceSettings{}, err
+	}
+	if len(pool.endpoints) > 1 {
+		endpoints = pool
+		// probes go straight to their endpoint, without retries
+		probeClient := &http.Client{Transport: &headersTransport{base: transport, headers: headers}, Timeout: healthCheckTimeout}
+		for _, e := range endpoints.endpoints {
+			e.client, err = druid.NewClient(e.url.String(), append([]druid.ClientOption{druid.WithHTTPClient(probeClient), druid.WithRetryMax(0)}, authOpts...)...)
+			if err != nil {
+				return &druidInstanceSettings{}, err
+			}
+		}
+		failover := &failoverTransport{base: transport, primary: endpoints.endpoints[0].url, pool: endpoints}
+		if timeout := data.Get("connection.responseTimeout").MustInt(-1); timeout > 0 {
+			failover.responseTimeout = time.Duration(timeout) * time.Millisecond
+		}
+		roundTripper = failover
+	}
+
+	// the http client is kept aside to issue requests which must bypass the retry logic of the Druid client
+	httpClient := &http.Client{Transport: &headersTransport{base: roundTripper, headers: headers}}
+	druidOpts := append([]druid.ClientOption{druid.WithHTTPClient(httpClient)}, authOpts...)
 	if retryMax := data.Get("connection.retryableRetryMax").MustInt(-1); retryMax != -1 {
 		druidOpts = append(druidOpts, druid.WithRetryMax(retryMax))
 	}
@@ -84,77 +147,59 @@ func newDataSourceInstance(settings backend.DataSourceInstanceSettings) (instanc
 	if retryWaitMax := data.Get("connection.retryableRetryWaitMax").MustInt(-1); retryWaitMax != -1 {
 		druidOpts = append(druidOpts, druid.WithRetryWaitMax(time.Duration(retryWaitMax)*time.Millisecond))
 	}
-	if basicAuth := data.Get("connection.basicAuth").MustBool(); basicAuth {
-		druidOpts = append(druidOpts, druid.WithBasicAuth(data.Get("connection.basicAuthUser").MustString(), secureData["connection.basicAuthPassword"]))
+	c, err := druid.NewClient(baseURL, druidOpts...)
+	if err != nil {
+		return &druidInstanceSettings{}, err
 	}
-	if mTLS := data.Get("connection.mTLS").MustBool(); mTLS {
-		log.DefaultLogger.Info("mTLS enabled for Druid connection")
-
-		cert, ok := secureData["connection.mTLSCert"]
-		if !ok || cert == "" {
-			return &druidInstanceSettings{}, fmt.Errorf("mTLS certificate is required but not provided")
-		}
-		key, ok := secureData["connection.mTLSKey"]
-		if !ok || key == "" {
-			return &druidInstanceSettings{}, fmt.Errorf("mTLS key is required but not provided")
-		}
-		ca, hasCA := secureData["connection.mTLSCa"]
-
-		useSystemCAPool := data.Get("connection.mTLSUseSystemCaPool").MustBool()
-		if useSystemCAPool {
-			log.DefaultLogger.Info("Using system CA pool for Druid mTLS connection")
-		} else {
-			log.DefaultLogger.Info("Using custom CA for Druid mTLS connection")
-		}
-
-		clientCert, err := tls.X509KeyPair([]byte(cert), []byte(key))
-		if err != nil {
-			return &druidInstanceSettings{}, fmt.Errorf("failed to load client certificate and key: %w", err)
-		}
-
-		caCertPool := x509.NewCertPool()
-		if useSystemCAPool {
-			caCertPool, err = x509.SystemCertPool()
-			if err != nil {
-				return &druidInstanceSettings{}, fmt.Errorf("failed to load system CA pool: %w", err)
-			}
+	if endpoints != nil {
+		healthCheckInterval := defaultHealthCheckInterval
+		if interval := data.Get("connection.healthCheckInterval").MustInt(-1); interval > 0 {
+			healthCheckInterval = time.Duration(interval) * time.Millisecond
 		}
+		go endpoints.watch(healthCheckInterval)
+	}
 
-		if hasCA && !caCertPool.AppendCertsFromPEM([]byte(ca)) {
-			return &druidInstanceSettings{}, fmt.Errorf("failed to append CA certificate: %s", ca)
-		}
+	maxConcurrentQueries := defaultMaxConcurrentQueries
+	if maxQueries := data.Get("connection.maxConcurrentQueries").MustInt(-1); maxQueries > 0 {
+		maxConcurrentQueries = maxQueries
+	}
 
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{clientCert},
-			RootCAs:      caCertPool,
+	var cache *queryCache
+	if cacheTTL := data.Get("connection.queryCacheTtl").MustInt(-1); cacheTTL > 0 {
+		cacheMaxSize := defaultQueryCacheMaxSize
+		if maxSize := data.Get("connection.queryCacheMaxSize").MustInt(-1); maxSize > 0 {
+			cacheMaxSize = maxSize
 		}
+		cache = newQueryCache(time.Duration(cacheTTL)*time.Millisecond, cacheMaxSize*1024*1024)
+	}
 
-		httpClient := http.Client{}
-
-		if httpClient.Transport == nil {
-			httpClient.Transport = &http.Transport{}
+	var bucketCache *queryCache
+	if data.Get("connection.incrementalCache").MustBool() {
+		bucketCacheTTL := defaultIncrementalCacheTTL
+		if ttl := data.Get("connection.incrementalCacheTtl").MustInt(-1); ttl > 0 {
+			bucketCacheTTL = time.Duration(ttl) * time.Millisecond
 		}
-
-		transport, ok := httpClient.Transport.(*http.Transport)
-		if !ok {
-			return &druidInstanceSettings{}, fmt.Errorf("http transport is not of type *http.Transport")
+		bucketCacheMaxSize := defaultQueryCacheMaxSize
+		if maxSize := data.Get("connection.incrementalCacheMaxSize").MustInt(-1); maxSize > 0 {
+			bucketCacheMaxSize = maxSize
 		}
-
-		transport.TLSClientConfig = tlsConfig
-		druidOpts = append(druidOpts, druid.WithHTTPClient(&httpClient))
-	}
-
-	if skipTLS := data.Get("connection.skipTls").MustBool(); skipTLS {
-		druidOpts = append(druidOpts, druid.WithSkipTLSVerify())
-	}
-
-	c, err := druid.NewClient(data.Get("connection.url").MustString(), druidOpts...)
-	if err != nil {
-		return &druidInstanceSettings{}, err
+		bucketCache = newQueryCache(bucketCacheTTL, bucketCacheMaxSize*1024*1024)
 	}
 
 	return &druidInstanceSettings{
 		client:               c,
+		httpClient:           httpClient,
+		endpoints:            endpoints,
+		maxConcurrentQueries: maxConcurrentQueries,
+		catalog:              newColumnCatalog(),
+		cache:                cache,
+		bucketCache:          bucketCache,
+		inflight:             newInflightGroup(),
+		identity: identityForwarding{
+			oauthPassThru: data.Get("connection.oauthPassThru").MustBool(),
+			useIDToken:    data.Get("connection.oauthToken").MustString() == "id",
+			userHeader:    data.Get("connection.userHeader").MustString(),
+		},
 		defaultQuerySettings: prepareQuerySettings(settings.JSONData),
 	}, nil
 }
@@ -217,8 +262,45 @@ func (ds *druidDatasource) CallResource(ctx context.Context, req *backend.CallRe
 		default:
 			body = "Method not supported"
 		}
+	case "tag-keys":
+		switch req.Method {
+		case "POST":
+			body, err = ds.TagKeys(ctx, req)
+			if err == nil {
+				code = 200
+			}
+		default:
+			body = "Method not supported"
+		}
+	case "tag-values":
+		switch req.Method {
+		case "POST":
+			body, err = ds.TagValues(ctx, req)
+			if err == nil {
+				code = 200
+			}
+		default:
+			body = "Method not supported"
+		}
 	default:
-		body = "Path not supported"
+		handler := metadataResource(req.Path)
+		if handler == nil {
+			body = "Path not supported"
+			break
+		}
+		switch req.Method {
+		case "GET":
+			body, err = ds.MetadataData(ctx, req, handler)
+			if err == nil {
+				code = 200
+			}
+		default:
+			body = "Method not supported"
+		}
+	}
+	if err != nil {
+		// the error is the one Druid reported, if any
+		body = err.Error()
 	}
 	resp := &backend.CallResourceResponse{Status: code}
 	resp.Body, err = json.Marshal(body)
@@ -237,19 +319,20 @@ func (ds *druidDatasource) QueryVariableData(ctx context.Context, req *backend.C
 	if err != nil {
 		return []grafanaMetricFindValue{}, err
 	}
-	return ds.queryVariable(req.Body, s)
+	ctx = s.identity.withIdentity(ctx, resourceHeaders(req.Headers), req.PluginContext.User)
+	return ds.queryVariable(ctx, req.Body, s)
 }
 
-func (ds *druidDatasource) queryVariable(qry []byte, s *druidInstanceSettings) ([]grafanaMetricFindValue, error) {
+func (ds *druidDatasource) queryVariable(ctx context.Context, qry []byte, s *druidInstanceSettings) ([]grafanaMetricFindValue, error) {
 	log.DefaultLogger.Info("DRUID EXECUTE QUERY VARIABLE", "grafana_query", string(qry))
-	// feature: probably implement a short (1s ? 500ms ? configurable in datasource ? beware memory: constrain size ?) life cache (druidInstanceSettings.cache ?) and early return then
 	response := []grafanaMetricFindValue{}
-	q, stg, err := ds.prepareQuery(qry, s)
+	// variables are queried without any time range
+	q, stg, err := ds.prepareQuery(ctx, qry, backend.TimeRange{}, 0, s)
 	if err != nil {
 		return response, err
 	}
 	log.DefaultLogger.Info("DRUID EXECUTE QUERY VARIABLE", "druid_query", q)
-	r, err := ds.executeQuery("variable", q, s, stg)
+	r, err := ds.executeQuery(ctx, "variable", q, s, stg)
 	if err != nil {
 		return response, err
 	}
@@ -262,35 +345,34 @@ func (ds *druidDatasource) queryVariable(qry []byte, s *druidInstanceSettings) (
 func (ds *druidDatasource) prepareVariableResponse(resp *druidResponse, settings map[string]interface{}) ([]grafanaMetricFindValue, error) {
 	// refactor: probably some method that returns a container (make([]whattypeever, 0)) and its related appender func based on column type)
 	response := []grafanaMetricFindValue{}
+	// each element of multi-value dimensions and arrays is a distinct variable value
+	prepareArrays(resp, arrayHandlingExplode, "")
 	for ic, c := range resp.Columns {
 		for _, r := range resp.Rows {
 			switch c.Type {
 			case "string":
 				if r[ic] != nil {
-					response = append(response, grafanaMetricFindValue{Value: r[ic].(string), Text: r[ic].(string)})
+					// the value may not be a string when the type comes from the schema or the query
+					v := toJSONString(r[ic])
+					response = append(response, grafanaMetricFindValue{Value: v, Text: v})
 				}
 			case "float":
 				if r[ic] != nil {
-					response = append(response, grafanaMetricFindValue{Value: r[ic].(float64), Text: fmt.Sprintf("%f", r[ic].(float64))})
+					f := toFloat64(r[ic])
+					response = append(response, grafanaMetricFindValue{Value: f, Text: fmt.Sprintf("%f", f)})
 				}
 			case "int":
 				if r[ic] != nil {
-					i, err := strconv.Atoi(r[ic].(string))
-					if err != nil {
-						i = 0
-					}
-					response = append(response, grafanaMetricFindValue{Value: i, Text: r[ic].(string)})
+					i := toInt64(r[ic])
+					response = append(response, grafanaMetricFindValue{Value: i, Text: strconv.FormatInt(i, 10)})
 				}
-			case "bool":
-				var b bool
-				var err error
-				b, ok := r[ic].(bool)
-				if !ok {
-					b, err = strconv.ParseBool(r[ic].(string))
-					if err != nil {
-						b = false
-					}
+			case "json":
+				if r[ic] != nil {
+					j := toJSONString(r[ic])
+					response = append(response, grafanaMetricFindValue{Value: j, Text: j})
 				}
+			case "bool":
+				b := toBool(r[ic])
 				var i int
 				if b {
 					i = 1
@@ -300,19 +382,10 @@ func (ds *druidDatasource) prepareVariableResponse(resp *druidResponse, settings
 				response = append(response, grafanaMetricFindValue{Value: i, Text: strconv.FormatBool(b)})
 			case "time":
 				var t time.Time
-				var err error
 				if r[ic] == nil {
-					r[ic] = 0.0
-				}
-				switch r[ic].(type) {
-				case string:
-					t, err = time.Parse("2006-01-02T15:04:05.000Z", r[ic].(string))
-					if err != nil {
-						t = time.Now()
-					}
-				case float64:
-					sec, dec := math.Modf(r[ic].(float64) / 1000)
-					t = time.Unix(int64(sec), int64(dec*(1e9)))
+					t = time.Unix(0, 0)
+				} else {
+					t = toTime(r[ic])
 				}
 				response = append(response, grafanaMetricFindValue{Value: t.Unix(), Text: t.Format(time.UnixDate)})
 			}
@@ -333,7 +406,15 @@ func (ds *druidDatasource) CheckHealth(ctx context.Context, req *backend.CheckHe
 		return result, nil
 	}
 
-	status, _, err := i.(*druidInstanceSettings).client.Common().Status()
+	s := i.(*druidInstanceSettings)
+	ctx = s.identity.withIdentity(ctx, req.Headers, req.PluginContext.User)
+	var endpointsErr error
+	healthyEndpoints := 0
+	if s.endpoints != nil {
+		healthyEndpoints, endpointsErr = s.endpoints.check()
+	}
+	var status druid.Status
+	err = ds.getMetadata(ctx, s, druid.StatusEndpoint, &status)
 	if err != nil {
 		result.Message = "Can't fetch Druid status: " + err.Error()
 		return result, nil
@@ -341,6 +422,12 @@ func (ds *druidDatasource) CheckHealth(ctx context.Context, req *backend.CheckHe
 
 	result.Status = backend.HealthStatusOk
 	result.Message = fmt.Sprintf("Succesfully connected to Druid %s", status.Version)
+	if s.endpoints != nil {
+		result.Message += fmt.Sprintf(", %d/%d endpoints healthy", healthyEndpoints, len(s.endpoints.endpoints))
+		if endpointsErr != nil {
+			result.Message += ". Unhealthy: " + endpointsErr.Error()
+		}
+	}
 	return result, nil
 }
 
@@ -351,14 +438,44 @@ func (ds *druidDatasource) QueryData(ctx context.Context, req *backend.QueryData
 	if err != nil {
 		return response, err
 	}
+	ctx = s.identity.withIdentity(ctx, req.Headers, req.PluginContext.User)
 
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	workers := make(chan struct{}, s.maxConcurrentQueries)
 	for _, q := range req.Queries {
-		response.Responses[q.RefID] = ds.query(q, s)
+		wg.Add(1)
+		go func(q backend.DataQuery) {
+			defer wg.Done()
+			var r backend.DataResponse
+			select {
+			case workers <- struct{}{}:
+				r = ds.safeQuery(ctx, q, s)
+				<-workers
+			case <-ctx.Done():
+				r = backend.DataResponse{Error: ctx.Err()}
+			}
+			mu.Lock()
+			response.Responses[q.RefID] = r
+			mu.Unlock()
+		}(q)
 	}
+	wg.Wait()
 
 	return response, nil
 }
 
+// safeQuery makes sure a panicking query only fails its own response.
+func (ds *druidDatasource) safeQuery(ctx context.Context, qry backend.DataQuery, s *druidInstanceSettings) (response backend.DataResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Error("DRUID EXECUTE QUERY", "ref_id", qry.RefID, "panic", r, "stack", string(debug.Stack()))
+			response = backend.DataResponse{Error: fmt.Errorf("unexpected error while processing query %s: %v", qry.RefID, r)}
+		}
+	}()
+	return ds.query(ctx, qry, s)
+}
+
 func (ds *druidDatasource) settings(ctx backend.PluginContext) (*druidInstanceSettings, error) {
 	s, err := ds.im.Get(ctx)
 	if err != nil {
@@ -367,19 +484,18 @@ func (ds *druidDatasource) settings(ctx backend.PluginContext) (*druidInstanceSe
 	return s.(*druidInstanceSettings), nil
 }
 
-func (ds *druidDatasource) query(qry backend.DataQuery, s *druidInstanceSettings) backend.DataResponse {
+func (ds *druidDatasource) query(ctx context.Context, qry backend.DataQuery, s *druidInstanceSettings) backend.DataResponse {
 	log.DefaultLogger.Info("DRUID EXECUTE QUERY", "grafana_query", qry)
-	rawQuery := interpolateVariables(string(qry.JSON), qry.Interval, qry.TimeRange.Duration())
+	rawQuery := interpolateVariables(string(qry.JSON), qry.Interval, qry.TimeRange)
 
-	// feature: probably implement a short (1s ? 500ms ? configurable in datasource ? beware memory: constrain size ?) life cache (druidInstanceSettings.cache ?) and early return then
 	response := backend.DataResponse{}
-	q, stg, err := ds.prepareQuery([]byte(rawQuery), s)
+	q, stg, err := ds.prepareQuery(ctx, []byte(rawQuery), qry.TimeRange, qry.MaxDataPoints, s)
 	if err != nil {
 		response.Error = err
 		return response
 	}
 	log.DefaultLogger.Info("DRUID EXECUTE QUERY", "druid_query", q)
-	r, err := ds.executeQuery(qry.RefID, q, s, stg)
+	r, err := ds.executeQuery(ctx, qry.RefID, q, s, stg)
 	if err != nil {
 		response.Error = err
 		return response
@@ -394,8 +510,8 @@ func (ds *druidDatasource) query(qry backend.DataQuery, s *druidInstanceSettings
 	return response
 }
 
-func interpolateVariables(expr string, interval time.Duration, timeRange time.Duration) string {
-	rangeMs := timeRange.Milliseconds()
+func interpolateVariables(expr string, interval time.Duration, timeRange backend.TimeRange) string {
+	rangeMs := timeRange.Duration().Milliseconds()
 	rangeSRounded := int64(math.Round(float64(rangeMs) / 1000.0))
 
 	expr = multiReplace(expr, varIntervalMs, strconv.FormatInt(int64(interval/time.Millisecond), 10))
@@ -405,7 +521,7 @@ func interpolateVariables(expr string, interval time.Duration, timeRange time.Du
 	expr = multiReplace(expr, varRange, strconv.FormatInt(rangeSRounded, 10)+"s")
 	expr = multiReplace(expr, varRateInterval, interval.String())
 
-	return expr
+	return interpolateTemplateVariables(expr, timeRange)
 }
 
 func multiReplace(s string, olds []string, new string) string {
@@ -446,7 +562,7 @@ func formatDuration(inter time.Duration) string {
 	return "1ms"
 }
 
-func (ds *druidDatasource) prepareQuery(qry []byte, s *druidInstanceSettings) (druidquerybuilder.Query, map[string]interface{}, error) {
+func (ds *druidDatasource) prepareQuery(ctx context.Context, qry []byte, timeRange backend.TimeRange, maxDataPoints int64, s *druidInstanceSettings) (druidquerybuilder.Query, map[string]interface{}, error) {
 	var q druidQuery
 	err := json.Unmarshal(qry, &q)
 	if err != nil {
@@ -469,13 +585,84 @@ func (ds *druidDatasource) prepareQuery(qry []byte, s *druidInstanceSettings) (d
 			defaultQueryContext,
 			ds.prepareQueryContext(queryContextParameters.([]interface{})))
 	}
+	q.Builder["context"] = withQueryID(q.Builder["queryType"], q.Builder["context"].(map[string]interface{}))
+	settings := mergeSettings(s.defaultQuerySettings, q.Settings)
+	if useDashboardTimeRange, _ := settings["useDashboardTimeRange"].(bool); useDashboardTimeRange || !hasIntervals(q.Builder) {
+		withTimeRange(q.Builder, timeRange)
+	}
+	if sql, ok := q.Builder["query"].(string); ok && q.Builder["queryType"] == "sql" {
+		q.Builder["query"], err = interpolateMacros(sql, timeRange)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := sqlParameters(settings); err != nil {
+			return nil, nil, err
+		}
+		q.Builder["query"], err = sqlWithAdhocFilters(q.Builder["query"].(string), q.AdhocFilters)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if err := withAdhocFilters(q.Builder, q.AdhocFilters); err != nil {
+		return nil, nil, err
+	}
+	minInterval, _ := settings["minInterval"].(float64)
+	if period := withAutoGranularity(q.Builder, timeRange.Duration(), maxDataPoints, time.Duration(minInterval)*time.Millisecond); period != "" {
+		settings["autoGranularity"] = period
+	}
 	jsonQuery, err := json.Marshal(q.Builder)
 	if err != nil {
 		return nil, nil, err
 	}
 	query, err := s.client.Query().Load(jsonQuery)
-	// feature: could ensure __time column is selected, time interval is set based on qry given timerange and consider max data points ?
-	return query, mergeSettings(s.defaultQuerySettings, q.Settings), err
+	// feature: could ensure __time column is selected ?
+	return query, settings, err
+}
+
+// Query types which are run over intervals
+var intervalsQueryTypes = map[string]bool{
+	"timeseries":   true,
+	"topN":         true,
+	"groupBy":      true,
+	"scan":         true,
+	"search":       true,
+	"timeBoundary": true,
+}
+
+func hasIntervals(builder map[string]interface{}) bool {
+	ivs, _ := builder["intervals"].(map[string]interface{})
+	intervals, _ := ivs["intervals"].([]interface{})
+	return len(intervals) > 0
+}
+
+// withTimeRange sets the intervals of a native query to the Grafana query
+// time range so that queries don't depend on the frontend interpolating them,
+// which doesn't happen for alerting.
+func withTimeRange(builder map[string]interface{}, timeRange backend.TimeRange) {
+	queryType, _ := builder["queryType"].(string)
+	if !intervalsQueryTypes[queryType] || timeRange.From.IsZero() || timeRange.To.IsZero() {
+		return
+	}
+	interval := intervals.NewInterval().SetInterval(timeRange.From.UTC(), timeRange.To.UTC())
+	builder["intervals"] = map[string]interface{}{
+		"type":      "intervals",
+		"intervals": []interface{}{string(*interval)},
+	}
+}
+
+// withQueryID makes sure the query context carries an identifier Druid can use
+// to cancel the query. A user defined identifier is kept as is.
+func withQueryID(queryType interface{}, queryContext map[string]interface{}) map[string]interface{} {
+	if queryContext == nil {
+		queryContext = make(map[string]interface{})
+	}
+	key := "queryId"
+	if queryType == "sql" {
+		key = "sqlQueryId"
+	}
+	if id, ok := queryContext[key].(string); !ok || id == "" {
+		queryContext[key] = uuid.New().String()
+	}
+	return queryContext
 }
 
 func (ds *druidDatasource) prepareQueryContext(parameters []interface{}) map[string]interface{} {
@@ -489,399 +676,128 @@ func (ds *druidDatasource) prepareQueryContext(parameters []interface{}) map[str
 	return ctx
 }
 
-func (ds *druidDatasource) executeQuery(queryRef string, q druidquerybuilder.Query, s *druidInstanceSettings, settings map[string]interface{}) (*druidResponse, error) {
-	// refactor: probably need to extract per-query preprocessor and postprocessor into a per-query file. load those "plugins" (ak. QueryProcessor ?) into a register and then do something like plugins[q.Type()].preprocess(q) and plugins[q.Type()].postprocess(r)
-	r := &druidResponse{Reference: queryRef}
-	qtyp := q.Type()
-	switch qtyp {
-	case "sql":
-		q.(*druidquery.SQL).SetResultFormat("array").SetHeader(true)
-	case "scan":
-		q.(*druidquery.Scan).SetResultFormat("compactedList")
+func queryEndpoint(q druidquerybuilder.Query) string {
+	if q.Type() == "sql" {
+		return druid.SQLQueryEndpoint
+	}
+	return druid.NativeQueryEndpoint
+}
+
+func (ds *druidDatasource) runQuery(ctx context.Context, q druidquerybuilder.Query, s *druidInstanceSettings, result interface{}) error {
+	req, err := s.client.NewRequest("POST", queryEndpoint(q), q)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Do(req.WithContext(ctx), result)
+	if err != nil && ctx.Err() != nil {
+		// Grafana gave up on the query (dashboard closed, timeout...), make sure Druid does too
+		ds.cancelQuery(forwardedHeaders(ctx), q, s)
+	}
+	return err
+}
+
+func (ds *druidDatasource) cancelQuery(headers http.Header, q druidquerybuilder.Query, s *druidInstanceSettings) {
+	base := queryBase(q)
+	if base == nil {
+		return
+	}
+	key := "queryId"
+	if q.Type() == "sql" {
+		key = "sqlQueryId"
+	}
+	id, ok := base.Context[key].(string)
+	if !ok || id == "" {
+		return
+	}
+	req, err := s.client.NewRequest("DELETE", queryEndpoint(q)+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		log.DefaultLogger.Error("DRUID CANCEL QUERY", "query_id", id, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(withForwardedHeaders(context.Background(), headers), queryCancelTimeout)
+	defer cancel()
+	// Druid answers 202 Accepted with an empty body which the Druid client retry policy would retry
+	resp, err := s.httpClient.Do(req.Request.WithContext(ctx))
+	if err != nil {
+		log.DefaultLogger.Error("DRUID CANCEL QUERY", "query_id", id, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	if err := (&druid.Response{Response: resp}).ExtractError(); err != nil {
+		log.DefaultLogger.Error("DRUID CANCEL QUERY", "query_id", id, "error", err)
+		return
+	}
+	log.DefaultLogger.Info("DRUID CANCEL QUERY", "query_id", id)
+}
+
+func (ds *druidDatasource) executeQuery(ctx context.Context, queryRef string, q druidquerybuilder.Query, s *druidInstanceSettings, settings map[string]interface{}) (*druidResponse, error) {
+	p, ok := lookupQueryProcessor(q.Type())
+	if !ok {
+		return &druidResponse{Reference: queryRef}, errors.New("unknown query type")
+	}
+	qq := p.preProcess(q, settings)
+	key, err := queryCacheKey(qq, settings)
+	if err != nil {
+		log.DefaultLogger.Warn("DRUID QUERY KEY", "error", err)
+		return ds.processQuery(ctx, queryRef, p, q, qq, s, settings, "")
 	}
+	// users identified to Druid only share their own results
+	key += identityKey(ctx)
+	cacheKey := key
+	if disableCache, _ := settings["disableCache"].(bool); s.cache == nil || disableCache {
+		cacheKey = ""
+	}
+	// identical queries running concurrently share the same Druid query
+	v, err := s.inflight.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return ds.processQuery(ctx, queryRef, p, q, qq, s, settings, cacheKey)
+	})
+	r, _ := v.(*druidResponse)
+	if r == nil {
+		return &druidResponse{Reference: queryRef}, err
+	}
+	return r.copyFor(queryRef), err
+}
+
+func (ds *druidDatasource) processQuery(ctx context.Context, queryRef string, p queryProcessor, q, qq druidquerybuilder.Query, s *druidInstanceSettings, settings map[string]interface{}, cacheKey string) (*druidResponse, error) {
+	r := &druidResponse{Reference: queryRef}
 	var result json.RawMessage
-	_, err := s.client.Query().Execute(q, &result)
+	var err error
+	disableCache, _ := settings["disableCache"].(bool)
+	if iq, ok := newIncrementalQuery(qq); ok && s.bucketCache != nil && !disableCache {
+		result, r.CacheStatus, err = ds.runIncrementalQuery(ctx, iq, s)
+	} else {
+		result, r.CacheStatus, err = ds.runCachedQuery(ctx, qq, s, cacheKey)
+	}
 	if err != nil {
 		return r, err
 	}
-	detectColumnType := func(c *struct {
-		Name string
-		Type string
-	}, pos int, rr [][]interface{},
-	) {
-		t := map[string]int{"nil": 0}
-		for i := 0; i < len(rr); i += int(math.Ceil(float64(len(rr)) / 5.0)) {
-			r := rr[i]
-			switch r[pos].(type) {
-			case string:
-				v := r[pos].(string)
-				_, err := strconv.Atoi(v)
-				if err != nil {
-					_, err := strconv.ParseBool(v)
-					if err != nil {
-						_, err := time.Parse("2006-01-02T15:04:05.000Z", v)
-						if err != nil {
-							t["string"]++
-							continue
-						}
-						t["time"]++
-						continue
-					}
-					t["bool"]++
-					continue
-				}
-				t["int"]++
-				continue
-			case float64:
-				if c.Name == "__time" || strings.Contains(strings.ToLower(c.Name), "time_") {
-					t["time"]++
-					continue
-				}
-				t["float"]++
-				continue
-			case bool:
-				t["bool"]++
-				continue
-			}
-		}
-		election := func(values map[string]int) string {
-			type kv struct {
-				Key   string
-				Value int
-			}
-			var ss []kv
-			for k, v := range values {
-				ss = append(ss, kv{k, v})
-			}
-			sort.Slice(ss, func(i, j int) bool {
-				return ss[i].Value > ss[j].Value
-			})
-			if len(ss) == 2 {
-				return ss[0].Key
-			}
-			return "string"
-		}
-		c.Type = election(t)
-	}
-	switch qtyp {
-	case "sql":
-		var sqlr []interface{}
-		err := json.Unmarshal(result, &sqlr)
-		if err == nil && len(sqlr) > 1 {
-			for _, row := range sqlr[1:] {
-				r.Rows = append(r.Rows, row.([]interface{}))
-			}
-			for i, c := range sqlr[0].([]interface{}) {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c.(string)}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "timeseries":
-		var tsr []map[string]interface{}
-		err := json.Unmarshal(result, &tsr)
-		if err == nil && len(tsr) > 0 {
-			columns := []string{"timestamp"}
-			for c := range tsr[0]["result"].(map[string]interface{}) {
-				columns = append(columns, c)
-			}
-			for _, result := range tsr {
-				var row []interface{}
-				t := result["timestamp"]
-				if t == nil {
-					// grand total, lets keep it last
-					t = r.Rows[len(r.Rows)-1][0]
-				}
-				row = append(row, t)
-				colResults := result["result"].(map[string]interface{})
-				for _, c := range columns[1:] {
-					row = append(row, colResults[c])
-				}
-				r.Rows = append(r.Rows, row)
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "topN":
-		var tn []map[string]interface{}
-		err := json.Unmarshal(result, &tn)
-		if err == nil && len(tn) > 0 {
-			var columns []string
-			for _, result := range tn {
-				if columns == nil && len(result["result"].([]interface{})) > 0 {
-					columns = append(columns, "timestamp")
-					for c := range result["result"].([]interface{})[0].(map[string]interface{}) {
-						columns = append(columns, c)
-					}
-				}
-				for _, record := range result["result"].([]interface{}) {
-					var row []interface{}
-					row = append(row, result["timestamp"])
-					o, ok := record.(map[string]interface{})
-					if ok {
-						for _, c := range columns[1:] {
-							row = append(row, o[c])
-						}
-						r.Rows = append(r.Rows, row)
-					}
-				}
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "groupBy":
-		var gb []map[string]interface{}
-		err := json.Unmarshal(result, &gb)
-		if err == nil && len(gb) > 0 {
-			columns := []string{"timestamp"}
-			for c := range gb[0]["event"].(map[string]interface{}) {
-				columns = append(columns, c)
-			}
-			for _, result := range gb {
-				var row []interface{}
-				row = append(row, result["timestamp"])
-				colResults := result["event"].(map[string]interface{})
-				for _, c := range columns[1:] {
-					row = append(row, colResults[c])
-				}
-				r.Rows = append(r.Rows, row)
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "scan":
-		var scanr []map[string]interface{}
-		err := json.Unmarshal(result, &scanr)
-		if err == nil && len(scanr) > 0 {
-			for _, e := range scanr[0]["events"].([]interface{}) {
-				r.Rows = append(r.Rows, e.([]interface{}))
-			}
-			for i, c := range scanr[0]["columns"].([]interface{}) {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c.(string)}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "search":
-		var s []map[string]interface{}
-		err := json.Unmarshal(result, &s)
-		if err == nil && len(s) > 0 {
-			columns := []string{"timestamp"}
-			for c := range s[0]["result"].([]interface{})[0].(map[string]interface{}) {
-				columns = append(columns, c)
-			}
-			for _, result := range s {
-				for _, record := range result["result"].([]interface{}) {
-					var row []interface{}
-					row = append(row, result["timestamp"])
-					o := record.(map[string]interface{})
-					for _, c := range columns[1:] {
-						row = append(row, o[c])
-					}
-					r.Rows = append(r.Rows, row)
-				}
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "timeBoundary":
-		var tb []map[string]interface{}
-		err := json.Unmarshal(result, &tb)
-		if err == nil && len(tb) > 0 {
-			columns := []string{"timestamp"}
-			for c := range tb[0]["result"].(map[string]interface{}) {
-				columns = append(columns, c)
-			}
-			for _, result := range tb {
-				var row []interface{}
-				row = append(row, result["timestamp"])
-				colResults := result["result"].(map[string]interface{})
-				for _, c := range columns[1:] {
-					row = append(row, colResults[c])
-				}
-				r.Rows = append(r.Rows, row)
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "dataSourceMetadata":
-		var dsm []map[string]interface{}
-		err := json.Unmarshal(result, &dsm)
-		if err == nil && len(dsm) > 0 {
-			columns := []string{"timestamp"}
-			for c := range dsm[0]["result"].(map[string]interface{}) {
-				columns = append(columns, c)
-			}
-			for _, result := range dsm {
-				var row []interface{}
-				row = append(row, result["timestamp"])
-				colResults := result["result"].(map[string]interface{})
-				for _, c := range columns[1:] {
-					row = append(row, colResults[c])
-				}
-				r.Rows = append(r.Rows, row)
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
-		}
-	case "segmentMetadata":
-		var sm []map[string]interface{}
-		err := json.Unmarshal(result, &sm)
-		if err == nil && len(sm) > 0 {
-			var columns []string
-			switch settings["view"].(string) {
-			case "base":
-				for k, v := range sm[0] {
-					if k != "aggregators" && k != "columns" && k != "timestampSpec" {
-						if k == "intervals" {
-							for i := range v.([]interface{}) {
-								pos := strconv.Itoa(i)
-								columns = append(columns, "interval_start_"+pos)
-								columns = append(columns, "interval_stop_"+pos)
-							}
-						} else {
-							columns = append(columns, k)
-						}
-					}
-				}
-				for _, result := range sm {
-					var row []interface{}
-					for _, c := range columns {
-						var col interface{}
-						if strings.HasPrefix(c, "interval_") {
-							parts := strings.Split(c, "_")
-							pos := 0
-							if parts[1] == "stop" {
-								pos = 1
-							}
-							idx, err := strconv.Atoi(parts[2])
-							if err != nil {
-								return r, errors.New("interval parsing goes wrong")
-							}
-							ii := result["intervals"].([]interface{})[idx]
-							col = strings.Split(ii.(string), "/")[pos]
-						} else {
-							col = result[c]
-						}
-						row = append(row, col)
-					}
-					r.Rows = append(r.Rows, row)
-				}
-			case "aggregators":
-				for _, v := range sm[0]["aggregators"].(map[string]interface{}) {
-					columns = append(columns, "aggregator")
-					for k := range v.(map[string]interface{}) {
-						columns = append(columns, k)
-					}
-					break
-				}
-				for _, result := range sm {
-					for k, v := range result["aggregators"].(map[string]interface{}) {
-						var row []interface{}
-						for _, c := range columns {
-							var col interface{}
-							if c == "aggregator" {
-								col = k
-							} else {
-								col = v.(map[string]interface{})[c]
-							}
-							row = append(row, col)
-						}
-						r.Rows = append(r.Rows, row)
-					}
-				}
-			case "columns":
-				for _, v := range sm[0]["columns"].(map[string]interface{}) {
-					columns = append(columns, "column")
-					for k := range v.(map[string]interface{}) {
-						columns = append(columns, k)
-					}
-					break
-				}
-				for _, result := range sm {
-					for k, v := range result["columns"].(map[string]interface{}) {
-						var row []interface{}
-						for _, c := range columns {
-							var col interface{}
-							if c == "column" {
-								col = k
-							} else {
-								col = v.(map[string]interface{})[c]
-							}
-							row = append(row, col)
-						}
-						r.Rows = append(r.Rows, row)
-					}
-				}
-			case "timestampspec":
-				for k := range sm[0]["timestampSpec"].(map[string]interface{}) {
-					columns = append(columns, k)
-				}
-				for _, result := range sm {
-					var row []interface{}
-					for _, c := range columns {
-						col := result["timestampSpec"].(map[string]interface{})[c]
-						row = append(row, col)
-					}
-					r.Rows = append(r.Rows, row)
-				}
-			}
-			for i, c := range columns {
-				col := struct {
-					Name string
-					Type string
-				}{Name: c}
-				detectColumnType(&col, i, r.Rows)
-				r.Columns = append(r.Columns, col)
-			}
+	if err := p.postProcess(q, result, r, settings); err != nil {
+		return r, err
+	}
+	if tp, ok := p.(schemaTypedProcessor); ok {
+		ds.applyColumnTypes(ctx, q, r, s, tp.outputTypes(q))
+	}
+	expandComplexColumns(r, complexExpansions(q))
+	return r, nil
+}
 
+// runCachedQuery runs a query unless its result is in the cache, caching is
+// disabled when the cache key is empty.
+func (ds *druidDatasource) runCachedQuery(ctx context.Context, q druidquerybuilder.Query, s *druidInstanceSettings, cacheKey string) (json.RawMessage, string, error) {
+	var result json.RawMessage
+	if cacheKey != "" {
+		if cached, ok := s.cache.get(cacheKey); ok {
+			return cached, "hit", nil
 		}
-	default:
-		return r, errors.New("unknown query type")
 	}
-	return r, err
+	if err := ds.runQuery(ctx, q, s, &result); err != nil {
+		return nil, "", err
+	}
+	if cacheKey == "" {
+		return result, "", nil
+	}
+	s.cache.set(cacheKey, result)
+	return result, "miss", nil
 }
 
 func (ds *druidDatasource) prepareResponse(resp *druidResponse, settings map[string]interface{}) (backend.DataResponse, error) {
@@ -890,6 +806,7 @@ func (ds *druidDatasource) prepareResponse(resp *druidResponse, settings map[str
 	frame := data.NewFrame(resp.Reference)
 	// fetch settings
 	hideEmptyColumns, _ := settings["hideEmptyColumns"].(bool)
+	legacyNullHandling, _ := settings["legacyNullHandling"].(bool)
 	responseLimit, _ := settings["responseLimit"].(float64)
 	format, found := settings["format"]
 	if !found {
@@ -897,7 +814,13 @@ func (ds *druidDatasource) prepareResponse(resp *druidResponse, settings map[str
 	} else {
 		format = format.(string)
 	}
+	arrayHandling, _ := settings["arrayHandling"].(string)
+	arraySeparator, ok := settings["arraySeparator"].(string)
+	if !ok {
+		arraySeparator = defaultArraySeparator
+	}
 	// turn druid response into grafana long frame
+	prepareArrays(resp, arrayHandling, arraySeparator)
 	if responseLimit > 0 && len(resp.Rows) > int(responseLimit) {
 		resp.Rows = resp.Rows[:int(responseLimit)]
 		response.Error = fmt.Errorf("query response limit exceeded (> %d rows): consider adding filters and/or reducing the query time range", int(responseLimit))
@@ -907,17 +830,19 @@ func (ds *druidDatasource) prepareResponse(resp *druidResponse, settings map[str
 		columnIsEmpty := true
 		switch c.Type {
 		case "string":
-			ff = make([]string, 0)
+			ff = make([]*string, 0)
 		case "float":
-			ff = make([]float64, 0)
+			ff = make([]*float64, 0)
 		case "int":
-			ff = make([]int64, 0)
+			ff = make([]*int64, 0)
 		case "bool":
-			ff = make([]bool, 0)
+			ff = make([]*bool, 0)
 		case "nil":
-			ff = make([]string, 0)
+			ff = make([]*string, 0)
+		case "json":
+			ff = make([]*string, 0)
 		case "time":
-			ff = make([]time.Time, 0)
+			ff = make([]*time.Time, 0)
 		}
 		for _, r := range resp.Rows {
 			if columnIsEmpty && r[ic] != nil && r[ic] != "" {
@@ -925,58 +850,60 @@ func (ds *druidDatasource) prepareResponse(resp *druidResponse, settings map[str
 			}
 			switch c.Type {
 			case "string":
-				if r[ic] == nil {
-					r[ic] = ""
+				var v *string
+				if r[ic] != nil {
+					// the value may not be a string when the type comes from the schema or the query
+					s := toJSONString(r[ic])
+					v = &s
 				}
-				ff = append(ff.([]string), r[ic].(string))
+				ff = append(ff.([]*string), v)
 			case "float":
-				if r[ic] == nil {
-					r[ic] = 0.0
+				var v *float64
+				if r[ic] != nil {
+					f := toFloat64(r[ic])
+					v = &f
 				}
-				ff = append(ff.([]float64), r[ic].(float64))
+				ff = append(ff.([]*float64), v)
 			case "int":
-				if r[ic] == nil {
-					r[ic] = "0"
-				}
-				i, err := strconv.Atoi(r[ic].(string))
-				if err != nil {
-					i = 0
+				var v *int64
+				if r[ic] != nil {
+					i := toInt64(r[ic])
+					v = &i
 				}
-				ff = append(ff.([]int64), int64(i))
+				ff = append(ff.([]*int64), v)
 			case "bool":
-				var b bool
-				var err error
-				b, ok := r[ic].(bool)
-				if !ok {
-					b, err = strconv.ParseBool(r[ic].(string))
-					if err != nil {
-						b = false
-					}
+				var v *bool
+				if r[ic] != nil {
+					b := toBool(r[ic])
+					v = &b
+				}
+				ff = append(ff.([]*bool), v)
+			case "json":
+				var v *string
+				if r[ic] != nil {
+					j := toJSONString(r[ic])
+					v = &j
 				}
-				ff = append(ff.([]bool), b)
+				ff = append(ff.([]*string), v)
 			case "nil":
-				ff = append(ff.([]string), "nil")
+				ff = append(ff.([]*string), nil)
 			case "time":
-				if r[ic] == nil {
-					r[ic] = 0.0
-				}
-				switch r[ic].(type) {
-				case string:
-					t, err := time.Parse("2006-01-02T15:04:05.000Z", r[ic].(string))
-					if err != nil {
-						t = time.Now()
-					}
-					ff = append(ff.([]time.Time), t)
-				case float64:
-					sec, dec := math.Modf(r[ic].(float64) / 1000)
-					ff = append(ff.([]time.Time), time.Unix(int64(sec), int64(dec*(1e9))))
+				var v *time.Time
+				if r[ic] != nil {
+					t := toTime(r[ic])
+					v = &t
 				}
+				ff = append(ff.([]*time.Time), v)
 			}
 		}
 		if hideEmptyColumns && columnIsEmpty {
 			continue
 		}
-		frame.Fields = append(frame.Fields, data.NewField(c.Name, nil, ff))
+		field := data.NewField(c.Name, nil, ff)
+		if legacyNullHandling {
+			field = zeroFilled(field, c.Type)
+		}
+		frame.Fields = append(frame.Fields, field)
 	}
 	// convert to other formats if specified
 	if format == "wide" && len(frame.Fields) > 0 {
@@ -990,10 +917,146 @@ func (ds *druidDatasource) prepareResponse(resp *druidResponse, settings map[str
 			frame = f
 		}
 	}
+	custom := make(map[string]interface{})
+	if resp.CacheStatus != "" {
+		custom["cache"] = resp.CacheStatus
+	}
+	if period, ok := settings["autoGranularity"].(string); ok {
+		custom["granularity"] = period
+	}
+	if len(custom) > 0 {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Custom = custom
+	}
 	response.Frames = append(response.Frames, frame)
 	return response, nil
 }
 
+// zeroFilled turns a nullable field into its non nullable counterpart, nulls
+// being replaced by zero values as it was done before nullable fields support.
+func zeroFilled(f *data.Field, columnType string) *data.Field {
+	zf := data.NewFieldFromFieldType(f.Type().NonNullableType(), f.Len())
+	zf.Name = f.Name
+	zf.Labels = f.Labels
+	for i := 0; i < f.Len(); i++ {
+		if v, ok := f.ConcreteAt(i); ok {
+			zf.Set(i, v)
+			continue
+		}
+		switch columnType {
+		case "nil":
+			zf.Set(i, "nil")
+		case "time":
+			zf.Set(i, time.Unix(0, 0))
+		}
+	}
+	return zf
+}
+
+// toInt64 converts a Druid value to an integer, unparsable values being 0.
+func toInt64(v interface{}) int64 {
+	switch vv := v.(type) {
+	case string:
+		i, err := strconv.ParseInt(vv, 10, 64)
+		if err != nil {
+			return 0
+		}
+		return i
+	case json.Number:
+		i, err := vv.Int64()
+		if err != nil {
+			f, err := vv.Float64()
+			if err != nil {
+				return 0
+			}
+			return int64(f)
+		}
+		return i
+	case float64:
+		return int64(vv)
+	}
+	return 0
+}
+
+// toFloat64 converts a Druid value to a float, unparsable values being 0.
+func toFloat64(v interface{}) float64 {
+	switch vv := v.(type) {
+	case json.Number:
+		f, err := vv.Float64()
+		if err != nil {
+			return 0
+		}
+		return f
+	case string:
+		f, err := strconv.ParseFloat(vv, 64)
+		if err != nil {
+			return 0
+		}
+		return f
+	case float64:
+		return vv
+	}
+	return 0
+}
+
+// toTime converts a Druid timestamp, either an ISO string or milliseconds since
+// epoch, to a time. Unparsable strings are considered as now.
+func toTime(v interface{}) time.Time {
+	switch vv := v.(type) {
+	case string:
+		t, err := time.Parse("2006-01-02T15:04:05.000Z", vv)
+		if err != nil {
+			t = time.Now()
+		}
+		return t
+	case json.Number:
+		if ms, err := vv.Int64(); err == nil {
+			return time.UnixMilli(ms)
+		}
+		return toTime(toFloat64(vv))
+	case float64:
+		sec, dec := math.Modf(vv / 1000)
+		return time.Unix(int64(sec), int64(dec*(1e9)))
+	}
+	return time.Unix(0, 0)
+}
+
+// toBool converts a Druid value to a boolean, unparsable values being false.
+func toBool(v interface{}) bool {
+	switch vv := v.(type) {
+	case bool:
+		return vv
+	case string:
+		b, err := strconv.ParseBool(vv)
+		if err != nil {
+			return false
+		}
+		return b
+	case json.Number:
+		return toFloat64(vv) != 0
+	case float64:
+		return vv != 0
+	}
+	return false
+}
+
+// toJSONString renders complex Druid values (arrays, objects...) as JSON.
+func toJSONString(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(j)
+}
+
 func longToLog(longFrame *data.Frame, settings map[string]interface{}) (*data.Frame, error) {
 	logFrame := data.NewFrame("response")
 	logFrame.SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeLogs})
@@ -1035,4 +1098,4 @@ func longToLog(longFrame *data.Frame, settings map[string]interface{}) (*data.Fr
 		logFrame.Fields = append(logFrame.Fields, f)
 	}
 	return logFrame, nil
-}
\ No newline at end of file
+}
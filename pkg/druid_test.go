@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestPrepareResponseNonStringValueInStringColumn(t *testing.T) {
+	// e.g. a stringLast aggregator not finalized, typed string from the query
+	resp := &druidResponse{
+		Columns: []druidColumn{{Name: "last", Type: "string"}},
+		Rows:    [][]interface{}{{json.Number("42")}, {map[string]interface{}{"rhs": "a"}}, {"b"}, {nil}},
+	}
+	r, err := (&druidDatasource{}).prepareResponse(resp, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.Frames[0].Fields[0]
+	want := []string{"42", `{"rhs":"a"}`, "b"}
+	for i, w := range want {
+		if v, ok := f.ConcreteAt(i); !ok || v != w {
+			t.Errorf("row %d: expected %s, got %v", i, w, v)
+		}
+	}
+	if _, ok := f.ConcreteAt(3); ok {
+		t.Errorf("expected a null, got %v", f.At(3))
+	}
+}
+
+func TestPrepareVariableResponseNonStringValueInStringColumn(t *testing.T) {
+	resp := &druidResponse{
+		Columns: []druidColumn{{Name: "last", Type: "string"}},
+		Rows:    [][]interface{}{{json.Number("42")}, {"b"}, {nil}},
+	}
+	values, err := (&druidDatasource{}).prepareVariableResponse(resp, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0].Text != "42" || values[1].Text != "b" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestCallResourceErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Druid went wrong"}`))
+	}))
+	defer server.Close()
+	ds := newDatasource().CallResourceHandler.(*druidDatasource)
+	pluginContext := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			UID:      "druid",
+			JSONData: []byte(`{"connection.url":"` + server.URL + `","connection.retryableRetryMax":0}`),
+		},
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "query-variable", `{"builder":{"queryType":"sql","query":"SELECT page FROM wiki"},"settings":{}}`},
+		{"POST", "tag-values", `{"datasource":"wiki","key":"page"}`},
+		{"GET", "datasources", ``},
+	}
+	for _, tt := range tests {
+		sender := &testResourceSender{}
+		err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+			PluginContext: pluginContext,
+			Method:        tt.method,
+			Path:          tt.path,
+			Body:          []byte(tt.body),
+		}, sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := sender.resp
+		var body string
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			t.Fatalf("%s: expected an error message, got %s", tt.path, resp.Body)
+		}
+		if resp.Status != http.StatusInternalServerError || !strings.Contains(body, "Druid went wrong") {
+			t.Errorf("%s: expected the Druid error, got %d %s", tt.path, resp.Status, body)
+		}
+	}
+}
+
+type testResourceSender struct {
+	resp *backend.CallResourceResponse
+}
+
+func (s *testResourceSender) Send(resp *backend.CallResourceResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func testQueryDataPluginContext(url string, jsonData string) backend.PluginContext {
+	return backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			UID:      "druid",
+			JSONData: []byte(`{"connection.url":"` + url + `","connection.retryableRetryMax":0` + jsonData + `}`),
+		},
+	}
+}
+
+func testSQLDataQuery(refID string, sql string, settings string) backend.DataQuery {
+	return backend.DataQuery{
+		RefID: refID,
+		JSON:  []byte(`{"builder":{"queryType":"sql","query":"` + sql + `"},"settings":` + settings + `}`),
+	}
+}
+
+func TestQueryDataIsolatesFailingQueries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&q)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(q["query"].(string), "missing") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Plan validation failed","errorMessage":"Object 'missing' not found"}`))
+			return
+		}
+		w.Write([]byte(`[["page"],["Main"]]`))
+	}))
+	defer server.Close()
+	ds := newDatasource().QueryDataHandler.(*druidDatasource)
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: testQueryDataPluginContext(server.URL, ``),
+		Queries: []backend.DataQuery{
+			testSQLDataQuery("A", "SELECT page FROM wiki", `{}`),
+			// the context parameters must be an array, processing the query panics
+			testSQLDataQuery("B", "SELECT page FROM wiki WHERE 1 = 1", `{"contextParameters":"sqlTimeZone"}`),
+			testSQLDataQuery("C", "SELECT page FROM missing", `{}`),
+			testSQLDataQuery("D", "SELECT page FROM wiki WHERE 2 = 2", `{}`),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, refID := range []string{"A", "D"} {
+		r := resp.Responses[refID]
+		if r.Error != nil || len(r.Frames) != 1 || r.Frames[0].Rows() != 1 {
+			t.Errorf("%s: expected a frame of 1 row, got %v %v", refID, r.Frames, r.Error)
+		}
+	}
+	if err := resp.Responses["B"].Error; err == nil || !strings.Contains(err.Error(), "unexpected error while processing query B") {
+		t.Errorf("B: expected the panic as error, got %v", err)
+	}
+	if err := resp.Responses["C"].Error; err == nil || !strings.Contains(err.Error(), "Object 'missing' not found") {
+		t.Errorf("C: expected the Druid error, got %v", err)
+	}
+}
+
+func TestQueryDataMaxConcurrentQueries(t *testing.T) {
+	var running, maxRunning, requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[["page"],["Main"]]`))
+	}))
+	defer server.Close()
+	ds := newDatasource().QueryDataHandler.(*druidDatasource)
+	var queries []backend.DataQuery
+	for _, refID := range []string{"A", "B", "C", "D", "E", "F"} {
+		queries = append(queries, testSQLDataQuery(refID, "SELECT page FROM wiki WHERE '"+refID+"' = 'x'", `{}`))
+	}
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: testQueryDataPluginContext(server.URL, `,"connection.maxConcurrentQueries":2`),
+		Queries:       queries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range queries {
+		if r := resp.Responses[q.RefID]; r.Error != nil {
+			t.Errorf("%s: %v", q.RefID, r.Error)
+		}
+	}
+	if requests != int32(len(queries)) {
+		t.Errorf("expected %d requests to Druid, got %d", len(queries), requests)
+	}
+	if maxRunning != 2 {
+		t.Errorf("expected 2 queries run at once, got %d", maxRunning)
+	}
+}
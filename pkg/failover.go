@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafadruid/go-druid"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	// Interval between two probes of the unhealthy endpoints when not configured
+	defaultHealthCheckInterval = 30 * time.Second
+	// Maximum time given to an endpoint to answer a probe
+	healthCheckTimeout = 10 * time.Second
+	// Maximum size of the error responses read to tell query errors from endpoint failures
+	maxErrorBodySize = 1024 * 1024
+)
+
+// Ways to pick the endpoint a request is sent to
+const (
+	priorityLoadBalancing   = "priority"
+	roundRobinLoadBalancing = "roundRobin"
+)
+
+// Endpoints to which read queries can be sent again when another one failed
+var idempotentEndpoints = map[string]bool{
+	"druid/v2":     true,
+	"druid/v2/sql": true,
+}
+
+// Endpoints cancelling a query, whose identifier follows
+var cancelEndpoints = []string{"druid/v2/sql/", "druid/v2/"}
+
+// errResponseTimeout tells an endpoint didn't start answering a request within the response timeout
+var errResponseTimeout = errors.New("no response from Druid")
+
+// endpoint is a Druid broker or router, with its health as last observed.
+type endpoint struct {
+	url *url.URL
+	// client is pinned to the endpoint, to probe it
+	client *druid.Client
+
+	mu      sync.Mutex
+	healthy bool
+}
+
+func (e *endpoint) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy
+}
+
+func (e *endpoint) setHealthy(healthy bool) (changed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	changed = healthy != e.healthy
+	e.healthy = healthy
+	return changed
+}
+
+// endpointPool spreads the requests to Druid over several brokers or routers,
+// keeping aside the ones failing until a probe finds them healthy again.
+type endpointPool struct {
+	endpoints  []*endpoint
+	roundRobin bool
+	next       uint32
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func newEndpointPool(urls []string, loadBalancing string) (*endpointPool, error) {
+	p := &endpointPool{
+		roundRobin: loadBalancing == roundRobinLoadBalancing,
+		stop:       make(chan struct{}),
+	}
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		if !strings.HasSuffix(u, "/") {
+			u += "/"
+		}
+		parsed, err := url.ParseRequestURI(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Druid URL %s: %w", u, err)
+		}
+		p.endpoints = append(p.endpoints, &endpoint{url: parsed, healthy: true})
+	}
+	return p, nil
+}
+
+// candidates returns the endpoints to try a request on, in order: the healthy
+// ones as picked by the load balancing, then the unhealthy ones as a last resort.
+func (p *endpointPool) candidates() []*endpoint {
+	var healthy, unhealthy []*endpoint
+	for _, e := range p.endpoints {
+		if e.isHealthy() {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	if p.roundRobin && len(healthy) > 1 {
+		start := int(atomic.AddUint32(&p.next, 1)-1) % len(healthy)
+		healthy = append(healthy[start:], healthy[:start]...)
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (p *endpointPool) report(e *endpoint, err error) {
+	if e.setHealthy(err == nil) {
+		if err != nil {
+			log.DefaultLogger.Warn("DRUID ENDPOINT UNHEALTHY", "url", e.url.String(), "error", err)
+		} else {
+			log.DefaultLogger.Info("DRUID ENDPOINT HEALTHY", "url", e.url.String())
+		}
+	}
+}
+
+// probe checks the status of an endpoint.
+func (p *endpointPool) probe(e *endpoint) error {
+	_, _, err := e.client.Common().Status()
+	p.report(e, err)
+	return err
+}
+
+// watch probes the unhealthy endpoints at regular intervals until the pool is closed.
+func (p *endpointPool) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for _, e := range p.endpoints {
+				if !e.isHealthy() {
+					p.probe(e)
+				}
+			}
+		}
+	}
+}
+
+func (p *endpointPool) close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// failoverTransport sends the requests addressed to the primary endpoint to
+// the endpoints of a pool, and sends read queries again to the next endpoint
+// when one fails to answer them.
+type failoverTransport struct {
+	base    http.RoundTripper
+	primary *url.URL
+	pool    *endpointPool
+	// maximum time given to an endpoint to start answering, none when zero
+	responseTimeout time.Duration
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.primary.Host || !strings.HasPrefix(req.URL.Path, t.primary.Path) {
+		return t.base.RoundTrip(req)
+	}
+	path := strings.TrimPrefix(req.URL.Path, t.primary.Path)
+	if isQueryCancel(req.Method, path) {
+		return t.broadcast(req, path)
+	}
+	candidates := t.pool.candidates()
+	retryable := len(candidates) > 1 && t.idempotent(req.Method, path)
+	var body []byte
+	if retryable && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	for i, e := range candidates {
+		resp, err := t.send(endpointRequest(req, e, path, body))
+		if req.Context().Err() != nil {
+			// the caller gave up, which says nothing about the health of the endpoint
+			return resp, err
+		}
+		if errors.Is(err, errResponseTimeout) {
+			// nor does a slow query, which would be as slow on the other endpoints
+			return nil, err
+		}
+		if err == nil && (resp.StatusCode < http.StatusInternalServerError || isDruidError(resp)) {
+			t.pool.report(e, nil)
+			return resp, nil
+		}
+		failure := err
+		if failure == nil {
+			failure = fmt.Errorf("answered %s", resp.Status)
+		}
+		t.pool.report(e, failure)
+		if !retryable || i == len(candidates)-1 {
+			// the Druid client reports the error
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+			resp.Body.Close()
+		}
+		log.DefaultLogger.Warn("DRUID FAILOVER", "from", e.url.String(), "to", candidates[i+1].url.String(), "error", failure)
+	}
+	return nil, errors.New("no Druid endpoint")
+}
+
+// send sends a request to an endpoint, failing with errResponseTimeout when
+// the endpoint doesn't start answering within the response timeout.
+func (t *failoverTransport) send(r *http.Request) (*http.Response, error) {
+	if t.responseTimeout <= 0 {
+		return t.base.RoundTrip(r)
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	timer := time.AfterFunc(t.responseTimeout, cancel)
+	resp, err := t.base.RoundTrip(r.WithContext(ctx))
+	if !timer.Stop() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("%w within %s", errResponseTimeout, t.responseTimeout)
+	}
+	if err != nil {
+		cancel()
+		return resp, err
+	}
+	// the request context lasts as long as the response body is read
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// endpointRequest returns a request addressed to the primary endpoint readdressed to another one.
+func endpointRequest(req *http.Request, e *endpoint, path string, body []byte) *http.Request {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = e.url.Scheme
+	r.URL.Host = e.url.Host
+	r.URL.Path = e.url.Path + path
+	r.URL.RawPath = ""
+	r.Host = ""
+	if body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	return r
+}
+
+// broadcast sends a query cancellation to all the healthy endpoints, as the
+// query may run on any of them, and returns the first accepting it.
+func (t *failoverTransport) broadcast(req *http.Request, path string) (*http.Response, error) {
+	var targets []*endpoint
+	for _, e := range t.pool.endpoints {
+		if e.isHealthy() {
+			targets = append(targets, e)
+		}
+	}
+	if len(targets) == 0 {
+		targets = t.pool.endpoints
+	}
+	var accepted *http.Response
+	for i, e := range targets {
+		resp, err := t.base.RoundTrip(endpointRequest(req, e, path, nil))
+		if err == nil && resp.StatusCode < http.StatusMultipleChoices && accepted == nil {
+			accepted = resp
+			continue
+		}
+		if accepted == nil && i == len(targets)-1 {
+			// the Druid client reports the error
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+			resp.Body.Close()
+		}
+	}
+	return accepted, nil
+}
+
+// isQueryCancel tells whether a request cancels a query.
+func isQueryCancel(method, path string) bool {
+	if method != http.MethodDelete || idempotentEndpoints[strings.TrimSuffix(path, "/")] {
+		// not the query endpoints themselves
+		return false
+	}
+	for _, prefix := range cancelEndpoints {
+		if id := strings.TrimPrefix(path, prefix); id != path && id != "" && !strings.Contains(id, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isDruidError tells whether a response is an error reported by Druid about a
+// query, e.g. a query failure or timeout, rather than by an unavailable
+// endpoint or a proxy in front of it. The body is kept readable.
+func isDruidError(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	var e struct {
+		Error      string `json:"error"`
+		ErrorClass string `json:"errorClass"`
+	}
+	return json.Unmarshal(body, &e) == nil && (e.Error != "" || e.ErrorClass != "")
+}
+
+// idempotent tells whether a request can be sent again to another endpoint:
+// reads, and queries as long as they aren't ingestions.
+func (t *failoverTransport) idempotent(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return idempotentEndpoints[strings.TrimSuffix(path, "/")]
+	}
+	return false
+}
+
+// check probes all the endpoints, returning an error telling the unhealthy
+// ones, if any.
+func (p *endpointPool) check() (healthy int, err error) {
+	var failures []string
+	for _, e := range p.endpoints {
+		if err := p.probe(e); err != nil {
+			failures = append(failures, e.url.String()+": "+err.Error())
+			continue
+		}
+		healthy++
+	}
+	if len(failures) > 0 {
+		return healthy, errors.New(strings.Join(failures, ", "))
+	}
+	return healthy, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestFailoverTransport returns a transport failing over the given servers, in order.
+func newTestFailoverTransport(t *testing.T, loadBalancing string, servers ...*httptest.Server) (*failoverTransport, *endpointPool) {
+	t.Helper()
+	var urls []string
+	for _, s := range servers {
+		urls = append(urls, s.URL)
+	}
+	pool, err := newEndpointPool(urls, loadBalancing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	return &failoverTransport{base: base, primary: pool.endpoints[0].url, pool: pool}, pool
+}
+
+func TestFailoverResponseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var otherRequests int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&otherRequests, 1)
+		w.Write([]byte(`[]`))
+	}))
+	defer other.Close()
+	transport, pool := newTestFailoverTransport(t, priorityLoadBalancing, slow, other)
+	transport.responseTimeout = 50 * time.Millisecond
+
+	req, _ := http.NewRequest(http.MethodPost, slow.URL+"/druid/v2", strings.NewReader(`{"queryType":"timeBoundary"}`))
+	if _, err := transport.RoundTrip(req); !errors.Is(err, errResponseTimeout) {
+		t.Fatalf("expected a response timeout, got %v", err)
+	}
+	// a slow query says nothing about the health of the endpoint
+	if !pool.endpoints[0].isHealthy() {
+		t.Error("expected the slow endpoint to stay healthy")
+	}
+	if n := atomic.LoadInt32(&otherRequests); n != 0 {
+		t.Errorf("expected the query not to be sent again, got %d requests", n)
+	}
+}
+
+func TestFailoverResponseTimeoutOnlyAwaitsTheResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[`))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`]`))
+	}))
+	defer server.Close()
+	transport, _ := newTestFailoverTransport(t, priorityLoadBalancing, server, server)
+	transport.responseTimeout = 50 * time.Millisecond
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/druid/v2", strings.NewReader(`{}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err := ioutil.ReadAll(resp.Body); err != nil || string(body) != "[]" {
+		t.Errorf("expected the whole response, got %s %v", body, err)
+	}
+}
+
+func TestFailoverFromUnavailableEndpoint(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unavailable.Close()
+	proxied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy in front of a broker which is down
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`<html>Bad gateway</html>`))
+	}))
+	defer proxied.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer healthy.Close()
+	transport, pool := newTestFailoverTransport(t, priorityLoadBalancing, unavailable, proxied, healthy)
+
+	req, _ := http.NewRequest(http.MethodPost, unavailable.URL+"/druid/v2", strings.NewReader(`{"queryType":"timeBoundary"}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "[]" {
+		t.Errorf("expected the answer of the healthy endpoint, got %s", body)
+	}
+	if pool.endpoints[0].isHealthy() || pool.endpoints[1].isHealthy() {
+		t.Error("expected the failing endpoints to be unhealthy")
+	}
+	if !pool.endpoints[2].isHealthy() {
+		t.Error("expected the answering endpoint to be healthy")
+	}
+}
+
+func TestFailoverKeepsDruidErrors(t *testing.T) {
+	var otherRequests int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Query timeout","errorClass":"org.apache.druid.query.QueryTimeoutException"}`))
+	}))
+	defer failing.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&otherRequests, 1)
+	}))
+	defer other.Close()
+	transport, pool := newTestFailoverTransport(t, priorityLoadBalancing, failing, other)
+
+	req, _ := http.NewRequest(http.MethodPost, failing.URL+"/druid/v2", strings.NewReader(`{}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := ioutil.ReadAll(resp.Body); !strings.Contains(string(body), "Query timeout") {
+		t.Errorf("expected the Druid error, got %s", body)
+	}
+	if !pool.endpoints[0].isHealthy() || atomic.LoadInt32(&otherRequests) != 0 {
+		t.Error("expected a query error not to fail over")
+	}
+}
+
+func TestFailoverKeepsHealthWhenCallerGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	transport, pool := newTestFailoverTransport(t, priorityLoadBalancing, slow, other)
+
+	req, _ := http.NewRequest(http.MethodPost, slow.URL+"/druid/v2", strings.NewReader(`{}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(req.WithContext(ctx)); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !pool.endpoints[0].isHealthy() {
+		t.Error("expected the endpoint to stay healthy")
+	}
+}
+
+func TestFailoverBroadcastsQueryCancels(t *testing.T) {
+	var cancelled []string
+	var mu sync.Mutex
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodDelete && r.URL.Path == "/druid/v2/sql/query-1" {
+				mu.Lock()
+				cancelled = append(cancelled, name)
+				mu.Unlock()
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}
+	first := httptest.NewServer(handler("first"))
+	defer first.Close()
+	second := httptest.NewServer(handler("second"))
+	defer second.Close()
+	transport, _ := newTestFailoverTransport(t, roundRobinLoadBalancing, first, second)
+
+	req, _ := http.NewRequest(http.MethodDelete, first.URL+"/druid/v2/sql/query-1", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected the cancellation to be accepted, got %s", resp.Status)
+	}
+	if len(cancelled) != 2 {
+		t.Errorf("expected the query to be cancelled on every endpoint, got %v", cancelled)
+	}
+}
+
+func TestIsQueryCancel(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodDelete, "druid/v2/query-1", true},
+		{http.MethodDelete, "druid/v2/sql/query-1", true},
+		{http.MethodDelete, "druid/v2/sql", false},
+		{http.MethodDelete, "druid/v2/", false},
+		{http.MethodDelete, "druid/coordinator/v1/lookups/config/tier", false},
+		{http.MethodPost, "druid/v2/query-1", false},
+	}
+	for _, tt := range tests {
+		if got := isQueryCancel(tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: expected %t, got %t", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"time"
+)
+
+// The granularity to set on native queries for the plugin to choose it
+const autoGranularity = "auto"
+
+// autoGranularityCandidate is a granularity the plugin can pick, by increasing
+// bucket size. Its builder is a simple granularity when Druid has one, which
+// is aligned on UTC the same way, a duration granularity otherwise.
+type autoGranularityCandidate struct {
+	period   string
+	duration time.Duration
+	builder  interface{}
+}
+
+var autoGranularityCandidates = []autoGranularityCandidate{
+	{"PT1S", time.Second, "second"},
+	{"PT5S", 5 * time.Second, durationGranularity(5 * time.Second)},
+	{"PT10S", 10 * time.Second, durationGranularity(10 * time.Second)},
+	{"PT30S", 30 * time.Second, durationGranularity(30 * time.Second)},
+	{"PT1M", time.Minute, "minute"},
+	{"PT5M", 5 * time.Minute, durationGranularity(5 * time.Minute)},
+	{"PT10M", 10 * time.Minute, durationGranularity(10 * time.Minute)},
+	{"PT15M", 15 * time.Minute, "fifteen_minute"},
+	{"PT30M", 30 * time.Minute, "thirty_minute"},
+	{"PT1H", time.Hour, "hour"},
+	{"PT3H", 3 * time.Hour, durationGranularity(3 * time.Hour)},
+	{"PT6H", 6 * time.Hour, durationGranularity(6 * time.Hour)},
+	{"PT12H", 12 * time.Hour, durationGranularity(12 * time.Hour)},
+	{"P1D", 24 * time.Hour, "day"},
+	{"P1W", 7 * 24 * time.Hour, "week"},
+	{"P1M", 30 * 24 * time.Hour, "month"},
+	{"P3M", 91 * 24 * time.Hour, "quarter"},
+	{"P1Y", 365 * 24 * time.Hour, "year"},
+}
+
+// Query types which bucket results by granularity
+var granularityQueryTypes = map[string]bool{
+	"timeseries": true,
+	"topN":       true,
+	"groupBy":    true,
+	"search":     true,
+}
+
+func durationGranularity(d time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "duration",
+		"duration": d.Milliseconds(),
+		"origin":   "1970-01-01T00:00:00Z",
+	}
+}
+
+// withAutoGranularity replaces the auto granularity of a native query by the
+// finest one returning at most maxDataPoints buckets over the time range,
+// with buckets no smaller than minInterval. It returns the ISO 8601 period
+// of the chosen granularity, empty when the query doesn't use the auto one.
+func withAutoGranularity(builder map[string]interface{}, timeRange time.Duration, maxDataPoints int64, minInterval time.Duration) string {
+	queryType, _ := builder["queryType"].(string)
+	if g, _ := builder["granularity"].(string); g != autoGranularity || !granularityQueryTypes[queryType] {
+		return ""
+	}
+	if timeRange <= 0 {
+		// variables are queried without time range
+		builder["granularity"] = "all"
+		return ""
+	}
+	interval := minInterval
+	if maxDataPoints > 0 {
+		if i := timeRange / time.Duration(maxDataPoints); i > interval {
+			interval = i
+		}
+	}
+	candidate := autoGranularityCandidates[len(autoGranularityCandidates)-1]
+	for _, c := range autoGranularityCandidates {
+		if c.duration >= interval {
+			candidate = c
+			break
+		}
+	}
+	builder["granularity"] = candidate.builder
+	return candidate.period
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithAutoGranularity(t *testing.T) {
+	tests := []struct {
+		name          string
+		builder       map[string]interface{}
+		timeRange     time.Duration
+		maxDataPoints int64
+		minInterval   time.Duration
+		wantPeriod    string
+		want          interface{}
+	}{
+		{
+			name:          "max data points",
+			builder:       map[string]interface{}{"queryType": "timeseries", "granularity": "auto"},
+			timeRange:     24 * time.Hour,
+			maxDataPoints: 1000,
+			// 86.4s per point at least
+			wantPeriod: "PT5M",
+			want:       durationGranularity(5 * time.Minute),
+		},
+		{
+			name:          "simple granularity",
+			builder:       map[string]interface{}{"queryType": "groupBy", "granularity": "auto"},
+			timeRange:     24 * time.Hour,
+			maxDataPoints: 24,
+			wantPeriod:    "PT1H",
+			want:          "hour",
+		},
+		{
+			name:          "min interval",
+			builder:       map[string]interface{}{"queryType": "topN", "granularity": "auto"},
+			timeRange:     time.Hour,
+			maxDataPoints: 3600,
+			minInterval:   time.Minute,
+			wantPeriod:    "PT1M",
+			want:          "minute",
+		},
+		{
+			name:          "min interval between candidates",
+			builder:       map[string]interface{}{"queryType": "timeseries", "granularity": "auto"},
+			timeRange:     time.Hour,
+			maxDataPoints: 3600,
+			minInterval:   20 * time.Second,
+			wantPeriod:    "PT30S",
+			want:          durationGranularity(30 * time.Second),
+		},
+		{
+			name:       "no max data points",
+			builder:    map[string]interface{}{"queryType": "search", "granularity": "auto"},
+			timeRange:  time.Hour,
+			wantPeriod: "PT1S",
+			want:       "second",
+		},
+		{
+			name:          "capped at the largest candidate",
+			builder:       map[string]interface{}{"queryType": "timeseries", "granularity": "auto"},
+			timeRange:     100 * 365 * 24 * time.Hour,
+			maxDataPoints: 10,
+			wantPeriod:    "P1Y",
+			want:          "year",
+		},
+		{
+			name:          "no time range",
+			builder:       map[string]interface{}{"queryType": "timeseries", "granularity": "auto"},
+			maxDataPoints: 1000,
+			want:          "all",
+		},
+		{
+			name:          "other granularity",
+			builder:       map[string]interface{}{"queryType": "timeseries", "granularity": "day"},
+			timeRange:     time.Hour,
+			maxDataPoints: 1000,
+			want:          "day",
+		},
+		{
+			name:          "granularity object",
+			builder:       map[string]interface{}{"queryType": "timeseries", "granularity": map[string]interface{}{"type": "period", "period": "P1D"}},
+			timeRange:     time.Hour,
+			maxDataPoints: 1000,
+			want:          map[string]interface{}{"type": "period", "period": "P1D"},
+		},
+		{
+			name:          "query type without granularity",
+			builder:       map[string]interface{}{"queryType": "scan", "granularity": "auto"},
+			timeRange:     time.Hour,
+			maxDataPoints: 1000,
+			want:          "auto",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period := withAutoGranularity(tt.builder, tt.timeRange, tt.maxDataPoints, tt.minInterval)
+			if period != tt.wantPeriod {
+				t.Errorf("expected the period %q, got %q", tt.wantPeriod, period)
+			}
+			if !reflect.DeepEqual(tt.builder["granularity"], tt.want) {
+				t.Errorf("expected the granularity %v, got %v", tt.want, tt.builder["granularity"])
+			}
+		})
+	}
+}
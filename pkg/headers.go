@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+)
+
+// Prefixes of the custom headers settings, names being in the JSON data and
+// values in the secure JSON data under the same suffix, e.g:
+// connection.httpHeaderName1 and connection.httpHeaderValue1.
+const (
+	httpHeaderNamePrefix  = "connection.httpHeaderName"
+	httpHeaderValuePrefix = "connection.httpHeaderValue"
+)
+
+// staticHeaders returns the headers configured to be sent with every request
+// to Druid: the custom headers, and the bearer token authorization if enabled.
+func staticHeaders(data *simplejson.Json, secureData map[string]string) http.Header {
+	headers := http.Header{}
+	var keys []string
+	for k := range data.MustMap() {
+		if strings.HasPrefix(k, httpHeaderNamePrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := strings.TrimSpace(data.Get(k).MustString())
+		if name == "" {
+			continue
+		}
+		headers.Set(name, secureData[httpHeaderValuePrefix+strings.TrimPrefix(k, httpHeaderNamePrefix)])
+	}
+	if bearerAuth := data.Get("connection.bearerAuth").MustBool(); bearerAuth {
+		headers.Set(authorizationHeader, "Bearer "+secureData["connection.bearerToken"])
+	}
+	return headers
+}
+
+// headersTransport adds headers to the requests: the static ones first, then
+// the ones of the request context, so that a forwarded user identity takes
+// precedence over the identity of the datasource.
+type headersTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	forwarded := forwardedHeaders(req.Context())
+	if len(t.headers) > 0 || len(forwarded) > 0 {
+		req = req.Clone(req.Context())
+		for name, values := range t.headers {
+			req.Header[name] = values
+		}
+		for name, values := range forwarded {
+			req.Header[name] = values
+		}
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Headers Grafana sets on plugin requests when forwarding OAuth identities
+const (
+	authorizationHeader = "Authorization"
+	idTokenHeader       = "X-ID-Token"
+)
+
+// identityForwarding tells how the identity of the Grafana user issuing a
+// request is forwarded to Druid so that Druid authorizes it: its OAuth access
+// or ID token as a bearer token, and/or its login in a header.
+type identityForwarding struct {
+	oauthPassThru bool
+	useIDToken    bool
+	userHeader    string
+}
+
+// withIdentity returns a context carrying the headers forwarding the
+// identity of the user of a Grafana request.
+func (f identityForwarding) withIdentity(ctx context.Context, headers map[string]string, user *backend.User) context.Context {
+	forwarded := http.Header{}
+	if f.oauthPassThru {
+		if f.useIDToken {
+			if token := headerValue(headers, idTokenHeader); token != "" {
+				forwarded.Set(authorizationHeader, "Bearer "+token)
+			}
+		} else if authorization := headerValue(headers, authorizationHeader); authorization != "" {
+			forwarded.Set(authorizationHeader, authorization)
+		}
+	}
+	if f.userHeader != "" && user != nil && user.Login != "" {
+		forwarded.Set(f.userHeader, user.Login)
+	}
+	return withForwardedHeaders(ctx, forwarded)
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// resourceHeaders flattens the headers of a resource request.
+func resourceHeaders(headers map[string][]string) map[string]string {
+	flattened := make(map[string]string)
+	for k, v := range headers {
+		if len(v) > 0 {
+			flattened[k] = v[0]
+		}
+	}
+	return flattened
+}
+
+type forwardedHeadersKey struct{}
+
+// withForwardedHeaders returns a context whose headers are added to the requests sent to Druid.
+func withForwardedHeaders(ctx context.Context, headers http.Header) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, forwardedHeadersKey{}, headers)
+}
+
+func forwardedHeaders(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(forwardedHeadersKey{}).(http.Header)
+	return headers
+}
+
+// identityKey identifies the forwarded identity of a context, empty if none,
+// so that users don't get results cached for others.
+func identityKey(ctx context.Context) string {
+	headers := forwardedHeaders(ctx)
+	if len(headers) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name + ":" + strings.Join(headers[name], ",") + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
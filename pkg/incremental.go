@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	"github.com/grafadruid/go-druid/builder/granularity"
+	"github.com/grafadruid/go-druid/builder/intervals"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+// How long the buckets are cached when not configured, they don't change once complete
+const defaultIncrementalCacheTTL = time.Hour
+
+// Buckets ending less than this before a query are not cached, Druid may still be ingesting their data
+const incrementalCacheGracePeriod = time.Minute
+
+// Granularities whose buckets have a fixed size, aligned on UTC
+var fixedGranularities = map[string]time.Duration{
+	"second":         time.Second,
+	"minute":         time.Minute,
+	"fifteen_minute": 15 * time.Minute,
+	"thirty_minute":  30 * time.Minute,
+	"hour":           time.Hour,
+	"day":            24 * time.Hour,
+	"week":           7 * 24 * time.Hour,
+}
+
+// incrementalQuery is a timeseries query whose results can be cached bucket
+// by bucket, so that refreshing a dashboard only queries Druid for the buckets
+// which are not cached yet, usually the most recent ones.
+type incrementalQuery struct {
+	query      *druidquery.Timeseries
+	start, end time.Time
+	bucket     time.Duration
+}
+
+type timeInterval struct {
+	start, end time.Time
+}
+
+// newIncrementalQuery tells whether a query can be cached incrementally: a
+// timeseries over a single interval, with a fixed size granularity and whose
+// rows don't depend on each other.
+func newIncrementalQuery(q druidquerybuilder.Query) (*incrementalQuery, bool) {
+	t, ok := q.(*druidquery.Timeseries)
+	if !ok || t.Limit != 0 {
+		return nil, false
+	}
+	if grandTotal, _ := t.Context["grandTotal"].(bool); grandTotal {
+		return nil, false
+	}
+	g, ok := t.Granularity.(*granularity.Simple)
+	if !ok {
+		return nil, false
+	}
+	bucket, ok := fixedGranularities[strings.ToLower(string(*g))]
+	if !ok {
+		return nil, false
+	}
+	ivs, ok := t.Intervals.(*intervals.Intervals)
+	if !ok || len(ivs.Intervals) != 1 || ivs.Intervals[0] == nil {
+		return nil, false
+	}
+	bounds := strings.Split(string(*ivs.Intervals[0]), "/")
+	if len(bounds) != 2 {
+		return nil, false
+	}
+	start, err := time.Parse(time.RFC3339Nano, bounds[0])
+	if err != nil {
+		return nil, false
+	}
+	end, err := time.Parse(time.RFC3339Nano, bounds[1])
+	if err != nil || !start.Before(end) {
+		return nil, false
+	}
+	return &incrementalQuery{query: t, start: start.UTC(), end: end.UTC(), bucket: bucket}, true
+}
+
+// completeBuckets returns the start of the buckets entirely within the query
+// interval and old enough to be cached.
+func (iq *incrementalQuery) completeBuckets(now time.Time) []time.Time {
+	var buckets []time.Time
+	b := iq.start.Truncate(iq.bucket)
+	if b.Before(iq.start) {
+		b = b.Add(iq.bucket)
+	}
+	for ; !b.Add(iq.bucket).After(iq.end) && !b.Add(iq.bucket).After(now.Add(-incrementalCacheGracePeriod)); b = b.Add(iq.bucket) {
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// key identifies the query regardless of its interval.
+func (iq *incrementalQuery) key() (string, error) {
+	q := *iq.query
+	q.Intervals = nil
+	fingerprint, err := queryFingerprint(&q)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(h[:]), nil
+}
+
+func (iq *incrementalQuery) withIntervals(ranges []timeInterval) *druidquery.Timeseries {
+	var ivs []*intervals.Interval
+	for _, r := range ranges {
+		ivs = append(ivs, intervals.NewInterval().SetInterval(r.start, r.end))
+	}
+	q := *iq.query
+	q.SetIntervals(intervals.NewIntervals().SetIntervals(ivs))
+	return &q
+}
+
+func bucketCacheKey(key string, bucket time.Time) string {
+	return key + "@" + strconv.FormatInt(bucket.UnixMilli(), 10)
+}
+
+// runIncrementalQuery runs a timeseries query taking the buckets it can from
+// the cache, only querying Druid for the other ones, and returns the stitched
+// Druid result along with the cache status.
+func (ds *druidDatasource) runIncrementalQuery(ctx context.Context, iq *incrementalQuery, s *druidInstanceSettings) (json.RawMessage, string, error) {
+	key, err := iq.key()
+	if err != nil {
+		return nil, "", err
+	}
+	key += identityKey(ctx)
+	buckets := iq.completeBuckets(time.Now())
+	var rows []json.RawMessage
+	var missing []timeInterval
+	cursor := iq.start
+	hits := 0
+	for _, b := range buckets {
+		v, ok := s.bucketCache.get(bucketCacheKey(key, b))
+		if !ok {
+			continue
+		}
+		hits++
+		if b.After(cursor) {
+			missing = append(missing, timeInterval{cursor, b})
+		}
+		if string(v) != "null" {
+			rows = append(rows, v)
+		}
+		cursor = b.Add(iq.bucket)
+	}
+	if cursor.Before(iq.end) {
+		missing = append(missing, timeInterval{cursor, iq.end})
+	}
+	status := "partial"
+	if len(missing) == 0 {
+		status = "hit"
+	} else if hits == 0 {
+		status = "miss"
+	}
+	if len(missing) > 0 {
+		var fetched []json.RawMessage
+		if err := ds.runQuery(ctx, iq.withIntervals(missing), s, &fetched); err != nil {
+			return nil, "", err
+		}
+		fetchedBuckets := make(map[int64]json.RawMessage)
+		for _, row := range fetched {
+			if t, ok := rowTimestamp(row); ok {
+				fetchedBuckets[t.UnixMilli()] = row
+			}
+		}
+		for _, b := range buckets {
+			if !inIntervals(b, missing) {
+				continue
+			}
+			// empty buckets are cached too, Druid may skip them
+			row, ok := fetchedBuckets[b.UnixMilli()]
+			if !ok {
+				row = json.RawMessage("null")
+			}
+			s.bucketCache.set(bucketCacheKey(key, b), row)
+		}
+		rows = append(rows, fetched...)
+	}
+	descending := iq.query.Descending != nil && *iq.query.Descending
+	sort.SliceStable(rows, func(i, j int) bool {
+		ti, _ := rowTimestamp(rows[i])
+		tj, _ := rowTimestamp(rows[j])
+		if descending {
+			return ti.After(tj)
+		}
+		return ti.Before(tj)
+	})
+	if rows == nil {
+		rows = []json.RawMessage{}
+	}
+	result, err := json.Marshal(rows)
+	return result, status, err
+}
+
+func rowTimestamp(row json.RawMessage) (time.Time, bool) {
+	var r struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(row, &r); err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, r.Timestamp)
+	return t, err == nil
+}
+
+func inIntervals(t time.Time, ranges []timeInterval) bool {
+	for _, r := range ranges {
+		if !t.Before(r.start) && t.Before(r.end) {
+			return true
+		}
+	}
+	return false
+}
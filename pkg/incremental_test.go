@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIncrementalQueryKey(t *testing.T) {
+	key := func(interval string) string {
+		q := loadTestQuery(t, `{"queryType":"timeseries","dataSource":{"type":"table","name":"wiki"},"granularity":"hour","intervals":{"type":"intervals","intervals":["`+interval+`"]},"aggregations":[{"type":"count","name":"count"}]}`)
+		iq, ok := newIncrementalQuery(q)
+		if !ok {
+			t.Fatal("expected an incremental query")
+		}
+		k, err := iq.key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	k := key("2022-01-01T00:00:00Z/2022-01-02T00:00:00Z")
+	// a sha256, whatever the size of the query
+	if len(k) != 64 {
+		t.Errorf("expected a hashed key, got %s", k)
+	}
+	if other := key("2022-01-01T00:00:00Z/2022-01-03T00:00:00Z"); other != k {
+		t.Errorf("expected the key not to depend on the interval, got %s and %s", k, other)
+	}
+}
+
+const testIncrementalQuery = `{"queryType":"timeseries","dataSource":{"type":"table","name":"wiki"},"granularity":"hour","intervals":{"type":"intervals","intervals":["2022-01-01T00:00:00Z/2022-01-01T03:00:00Z"]},"aggregations":[{"type":"count","name":"count"}]}`
+
+func TestIncrementalCacheIndependentOfResultCache(t *testing.T) {
+	var requests int32
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"timestamp":"2022-01-01T00:00:00.000Z","result":{"count":1}},
+			{"timestamp":"2022-01-01T01:00:00.000Z","result":{"count":2}},
+			{"timestamp":"2022-01-01T02:00:00.000Z","result":{"count":3}}
+		]`))
+	})
+	s.catalog = nil
+	// a result cache whose entries expire before the next refresh
+	s.cache = newQueryCache(time.Nanosecond, 1024*1024)
+	s.bucketCache = newQueryCache(time.Hour, 1024*1024)
+	ds := &druidDatasource{}
+	p, _ := lookupQueryProcessor("timeseries")
+	q := loadTestQuery(t, testIncrementalQuery)
+	settings := map[string]interface{}{}
+
+	for i, want := range []string{"miss", "hit"} {
+		r, err := ds.processQuery(context.Background(), "A", p, q, p.preProcess(q, settings), s, settings, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.CacheStatus != want || len(r.Rows) != 3 {
+			t.Errorf("run %d: expected a %s of 3 rows, got a %s of %v", i, want, r.CacheStatus, r.Rows)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected the buckets to be cached, got %d requests", n)
+	}
+}
+
+func TestIncrementalCacheDisabled(t *testing.T) {
+	var requests int32
+	s := newTestCatalogSettings(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+	s.catalog = nil
+	s.cache = newQueryCache(time.Hour, 1024*1024)
+	ds := &druidDatasource{}
+	p, _ := lookupQueryProcessor("timeseries")
+	q := loadTestQuery(t, testIncrementalQuery)
+	settings := map[string]interface{}{}
+
+	// without bucket cache, the query is cached as a whole
+	for i, want := range []string{"miss", "hit"} {
+		r, err := ds.processQuery(context.Background(), "A", p, q, p.preProcess(q, settings), s, settings, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.CacheStatus != want {
+			t.Errorf("run %d: expected a %s, got a %s", i, want, r.CacheStatus)
+		}
+	}
+	if _, ok := s.cache.get("key"); !ok {
+		t.Error("expected the result to be cached")
+	}
+}
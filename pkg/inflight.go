@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// inflightGroup deduplicates identical calls to Druid executed concurrently,
+// e.g. queries: only the first one is sent to Druid, the others wait for and
+// share its result.
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+type inflightCall struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newInflightGroup() *inflightGroup {
+	return &inflightGroup{calls: make(map[string]*inflightCall)}
+}
+
+// do executes fn once for all the concurrent callers of a same key. fn runs
+// with its own context, only cancelled once every caller has given up, so
+// that a caller going away doesn't fail the others. The shared result must
+// not be modified by callers.
+func (g *inflightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		// the identity forwarded to Druid is part of the key
+		callCtx, cancel := context.WithCancel(withForwardedHeaders(context.Background(), forwardedHeaders(ctx)))
+		c = &inflightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			g.forget(key, c)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (g *inflightGroup) run(ctx context.Context, key string, c *inflightCall, fn func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Error("DRUID INFLIGHT CALL", "key", key, "panic", r, "stack", string(debug.Stack()))
+			c.err = fmt.Errorf("unexpected error while calling Druid: %v", r)
+		}
+		g.mu.Lock()
+		g.forget(key, c)
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	c.val, c.err = fn(ctx)
+}
+
+// forget removes the call from the group so that later callers start a new one.
+// The group lock must be held.
+func (g *inflightGroup) forget(key string, c *inflightCall) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// copyFor returns a copy of a shared response which can be modified by the caller.
+func (r *druidResponse) copyFor(queryRef string) *druidResponse {
+	cp := &druidResponse{
+		Reference:   queryRef,
+		Columns:     make([]druidColumn, len(r.Columns)),
+		Rows:        make([][]interface{}, len(r.Rows)),
+		CacheStatus: r.CacheStatus,
+	}
+	copy(cp.Columns, r.Columns)
+	for i, row := range r.Rows {
+		cp.Rows[i] = make([]interface{}, len(row))
+		copy(cp.Rows[i], row)
+	}
+	return cp
+}
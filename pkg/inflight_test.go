@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForWaiters waits for a number of callers to wait for the call of a key.
+func waitForWaiters(t *testing.T, g *inflightGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		waiters := 0
+		if ok {
+			waiters = c.waiters
+		}
+		g.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d waiters", n)
+}
+
+type inflightResult struct {
+	val interface{}
+	err error
+}
+
+func doAsync(g *inflightGroup, ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) chan inflightResult {
+	results := make(chan inflightResult, 1)
+	go func() {
+		v, err := g.do(ctx, key, fn)
+		results <- inflightResult{v, err}
+	}()
+	return results
+}
+
+func TestInflightCancelledLeaderDoesntFailWaiters(t *testing.T) {
+	g := newInflightGroup()
+	release := make(chan struct{})
+	calls := 0
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls++
+		select {
+		case <-release:
+			return "result", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leader := doAsync(g, leaderCtx, "key", fn)
+	waitForWaiters(t, g, "key", 1)
+	follower := doAsync(g, context.Background(), "key", fn)
+	waitForWaiters(t, g, "key", 2)
+
+	cancelLeader()
+	if r := <-leader; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("expected the leader to be cancelled, got %v", r.err)
+	}
+	close(release)
+	if r := <-follower; r.err != nil || r.val != "result" {
+		t.Fatalf("expected the follower to get the result, got %v %v", r.val, r.err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single call, got %d", calls)
+	}
+}
+
+func TestInflightCancelledOnceLastWaiterLeaves(t *testing.T) {
+	g := newInflightGroup()
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	first := doAsync(g, ctx1, "key", fn)
+	waitForWaiters(t, g, "key", 1)
+	second := doAsync(g, ctx2, "key", fn)
+	waitForWaiters(t, g, "key", 2)
+
+	cancel1()
+	<-first
+	select {
+	case <-cancelled:
+		t.Fatal("expected the call to go on while a caller waits for it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel2()
+	<-second
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the call to be cancelled once every caller left")
+	}
+	// a later caller starts a new call
+	g.mu.Lock()
+	_, ok := g.calls["key"]
+	g.mu.Unlock()
+	if ok {
+		t.Error("expected the cancelled call to be forgotten")
+	}
+}
+
+func TestInflightFailuresReachEveryWaiter(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func() (interface{}, error)
+		want string
+	}{
+		{"error", func() (interface{}, error) { return nil, errors.New("Druid failed") }, "Druid failed"},
+		{"panic", func() (interface{}, error) { panic("boom") }, "unexpected error while calling Druid: boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newInflightGroup()
+			release := make(chan struct{})
+			fn := func(ctx context.Context) (interface{}, error) {
+				<-release
+				return tt.fn()
+			}
+			var waiters []chan inflightResult
+			for i := 0; i < 3; i++ {
+				waiters = append(waiters, doAsync(g, context.Background(), "key", fn))
+				waitForWaiters(t, g, "key", i+1)
+			}
+			close(release)
+			for i, w := range waiters {
+				if r := <-w; r.err == nil || !strings.Contains(r.err.Error(), tt.want) {
+					t.Errorf("waiter %d: expected the error %q, got %v", i, tt.want, r.err)
+				}
+			}
+		})
+	}
+}
+
+func TestInflightForwardsIdentity(t *testing.T) {
+	g := newInflightGroup()
+	ctx := withForwardedHeaders(context.Background(), map[string][]string{authorizationHeader: {"Bearer alice"}})
+	v, err := g.do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		return forwardedHeaders(ctx).Get(authorizationHeader), nil
+	})
+	if err != nil || v != "Bearer alice" {
+		t.Errorf("expected the identity to be forwarded, got %v %v", v, err)
+	}
+}
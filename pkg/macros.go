@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const sqlTimestampFormat = "2006-01-02 15:04:05.000"
+
+var (
+	macroRegexp    = regexp.MustCompile(`^\$__(timeFilter|timeGroup|timeFrom|timeTo|unixEpochFilter)\b`)
+	intervalRegexp = regexp.MustCompile(`^(\d+)(ms|s|m|h|d|w|y)$`)
+)
+
+// sqlMacro expands a macro given its arguments.
+type sqlMacro struct {
+	args   int
+	expand func(args []string, timeRange backend.TimeRange) (string, error)
+}
+
+var sqlMacros = map[string]sqlMacro{
+	"timeFilter": {1, func(args []string, timeRange backend.TimeRange) (string, error) {
+		return fmt.Sprintf("%s BETWEEN %s AND %s", args[0], sqlTimestamp(timeRange.From), sqlTimestamp(timeRange.To)), nil
+	}},
+	"timeFrom": {0, func(args []string, timeRange backend.TimeRange) (string, error) {
+		return sqlTimestamp(timeRange.From), nil
+	}},
+	"timeTo": {0, func(args []string, timeRange backend.TimeRange) (string, error) {
+		return sqlTimestamp(timeRange.To), nil
+	}},
+	"timeGroup": {2, func(args []string, timeRange backend.TimeRange) (string, error) {
+		period, err := isoPeriod(args[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("TIME_FLOOR(%s, '%s')", args[0], period), nil
+	}},
+	"unixEpochFilter": {1, func(args []string, timeRange backend.TimeRange) (string, error) {
+		return fmt.Sprintf("%s >= %d AND %s <= %d", args[0], timeRange.From.Unix(), args[0], timeRange.To.Unix()), nil
+	}},
+}
+
+// interpolateMacros expands the time macros of a Druid SQL query, the same
+// way other Grafana SQL datasources do, so that queries evaluated without the
+// frontend, such as alert rules, are run over the right time range.
+func interpolateMacros(sql string, timeRange backend.TimeRange) (string, error) {
+	var b strings.Builder
+	var quote byte
+	pos := 0
+	for pos < len(sql) {
+		c := sql[pos]
+		if quote != 0 || c == '\'' || c == '"' {
+			// macros in string literals are left as is
+			if quote == 0 {
+				quote = c
+			} else if c == quote {
+				quote = 0
+			}
+			b.WriteByte(c)
+			pos++
+			continue
+		}
+		var loc []int
+		if c == '$' {
+			loc = macroRegexp.FindStringSubmatchIndex(sql[pos:])
+		}
+		if loc == nil {
+			b.WriteByte(c)
+			pos++
+			continue
+		}
+		name := sql[pos+loc[2] : pos+loc[3]]
+		macro := sqlMacros[name]
+		pos += loc[1]
+		var args []string
+		if pos < len(sql) && sql[pos] == '(' {
+			end, err := closingParenthesis(sql, pos)
+			if err != nil {
+				return "", fmt.Errorf("macro $__%s: %w", name, err)
+			}
+			args = macroArguments(sql[pos+1 : end])
+			pos = end + 1
+		} else if macro.args > 0 {
+			return "", fmt.Errorf("macro $__%s: missing arguments, expected $__%s(%s)", name, name, macroUsage(name))
+		}
+		if len(args) != macro.args {
+			return "", fmt.Errorf("macro $__%s: expected %d argument(s), got %d, expected $__%s(%s)", name, macro.args, len(args), name, macroUsage(name))
+		}
+		if name != "timeGroup" && (timeRange.From.IsZero() || timeRange.To.IsZero()) {
+			return "", fmt.Errorf("macro $__%s: no time range to filter on", name)
+		}
+		expanded, err := macro.expand(args, timeRange)
+		if err != nil {
+			return "", fmt.Errorf("macro $__%s: %w", name, err)
+		}
+		b.WriteString(expanded)
+	}
+	return b.String(), nil
+}
+
+func macroUsage(name string) string {
+	switch name {
+	case "timeGroup":
+		return "column, interval"
+	case "timeFilter", "unixEpochFilter":
+		return "column"
+	}
+	return ""
+}
+
+// closingParenthesis returns the position of the parenthesis closing the one
+// at the given position, ignoring those in string literals.
+func closingParenthesis(s string, open int) (int, error) {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("missing closing parenthesis")
+}
+
+// macroArguments splits arguments on the commas which aren't nested in
+// function calls nor string literals.
+func macroArguments(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var args []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func sqlTimestamp(t time.Time) string {
+	return fmt.Sprintf("TIMESTAMP '%s'", t.UTC().Format(sqlTimestampFormat))
+}
+
+// isoPeriod converts an interval, either a Grafana one (e.g: 5m, 1d) or an
+// ISO 8601 period, into an ISO 8601 period.
+func isoPeriod(interval string) (string, error) {
+	interval = strings.Trim(strings.TrimSpace(interval), `'"`)
+	if strings.HasPrefix(interval, "P") {
+		return interval, nil
+	}
+	m := intervalRegexp.FindStringSubmatch(interval)
+	if m == nil {
+		return "", fmt.Errorf("invalid interval %q, expected e.g: 5m, 1h, 1d or PT5M", interval)
+	}
+	n, _ := strconv.ParseInt(m[1], 10, 64)
+	switch m[2] {
+	case "ms":
+		return "PT" + strconv.FormatFloat(float64(n)/1000, 'f', -1, 64) + "S", nil
+	case "s":
+		return fmt.Sprintf("PT%dS", n), nil
+	case "m":
+		return fmt.Sprintf("PT%dM", n), nil
+	case "h":
+		return fmt.Sprintf("PT%dH", n), nil
+	case "d":
+		return fmt.Sprintf("P%dD", n), nil
+	case "w":
+		return fmt.Sprintf("P%dW", n), nil
+	default:
+		return fmt.Sprintf("P%dY", n), nil
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestInterpolateMacros(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2022, 1, 1, 2, 0, 0, 0, time.FixedZone("CET", 3600)),
+	}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "timeFilter",
+			sql:  `SELECT * FROM wiki WHERE $__timeFilter(__time)`,
+			want: `SELECT * FROM wiki WHERE __time BETWEEN TIMESTAMP '2022-01-01 00:00:00.000' AND TIMESTAMP '2022-01-01 01:00:00.000'`,
+		},
+		{
+			name: "timeFilter on an expression",
+			sql:  `SELECT * FROM wiki WHERE $__timeFilter(TIME_PARSE("date", 'yyyy-MM-dd'))`,
+			want: `SELECT * FROM wiki WHERE TIME_PARSE("date", 'yyyy-MM-dd') BETWEEN TIMESTAMP '2022-01-01 00:00:00.000' AND TIMESTAMP '2022-01-01 01:00:00.000'`,
+		},
+		{
+			name: "timeFrom and timeTo",
+			sql:  `SELECT * FROM wiki WHERE __time >= $__timeFrom() AND __time < $__timeTo`,
+			want: `SELECT * FROM wiki WHERE __time >= TIMESTAMP '2022-01-01 00:00:00.000' AND __time < TIMESTAMP '2022-01-01 01:00:00.000'`,
+		},
+		{
+			name: "timeGroup",
+			sql:  `SELECT $__timeGroup(__time, 5m), COUNT(*) FROM wiki GROUP BY 1`,
+			want: `SELECT TIME_FLOOR(__time, 'PT5M'), COUNT(*) FROM wiki GROUP BY 1`,
+		},
+		{
+			name: "timeGroup with an ISO period",
+			sql:  `SELECT $__timeGroup(__time, 'P1D') FROM wiki`,
+			want: `SELECT TIME_FLOOR(__time, 'P1D') FROM wiki`,
+		},
+		{
+			name: "unixEpochFilter",
+			sql:  `SELECT * FROM events WHERE $__unixEpochFilter(ts)`,
+			want: `SELECT * FROM events WHERE ts >= 1640995200 AND ts <= 1640998800`,
+		},
+		{
+			name: "macros in string literals",
+			sql:  `SELECT '$__timeFilter(__time)' AS "$__timeTo" FROM wiki WHERE $__timeFilter(__time)`,
+			want: `SELECT '$__timeFilter(__time)' AS "$__timeTo" FROM wiki WHERE __time BETWEEN TIMESTAMP '2022-01-01 00:00:00.000' AND TIMESTAMP '2022-01-01 01:00:00.000'`,
+		},
+		{
+			name: "unknown macros",
+			sql:  `SELECT $__timeFilterX, $__unknown(a) FROM wiki`,
+			want: `SELECT $__timeFilterX, $__unknown(a) FROM wiki`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateMacros(tt.sql, timeRange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInterpolateMacrosErrors(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2022, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name      string
+		sql       string
+		timeRange backend.TimeRange
+		want      string
+	}{
+		{
+			name:      "missing arguments",
+			sql:       `SELECT * FROM wiki WHERE $__timeFilter`,
+			timeRange: timeRange,
+			want:      `macro $__timeFilter: missing arguments, expected $__timeFilter(column)`,
+		},
+		{
+			name:      "missing argument",
+			sql:       `SELECT $__timeGroup(__time) FROM wiki`,
+			timeRange: timeRange,
+			want:      `macro $__timeGroup: expected 2 argument(s), got 1, expected $__timeGroup(column, interval)`,
+		},
+		{
+			name:      "no arguments",
+			sql:       `SELECT * FROM wiki WHERE $__unixEpochFilter()`,
+			timeRange: timeRange,
+			want:      `macro $__unixEpochFilter: expected 1 argument(s), got 0, expected $__unixEpochFilter(column)`,
+		},
+		{
+			name:      "extra argument",
+			sql:       `SELECT * FROM wiki WHERE $__timeFilter(__time, 1h)`,
+			timeRange: timeRange,
+			want:      `macro $__timeFilter: expected 1 argument(s), got 2, expected $__timeFilter(column)`,
+		},
+		{
+			name:      "argument to a macro without any",
+			sql:       `SELECT * FROM wiki WHERE __time > $__timeFrom(__time)`,
+			timeRange: timeRange,
+			want:      `macro $__timeFrom: expected 0 argument(s), got 1, expected $__timeFrom()`,
+		},
+		{
+			name:      "unclosed parenthesis",
+			sql:       `SELECT * FROM wiki WHERE $__timeFilter(__time`,
+			timeRange: timeRange,
+			want:      `macro $__timeFilter: missing closing parenthesis`,
+		},
+		{
+			name:      "closing parenthesis in a string literal",
+			sql:       `SELECT * FROM wiki WHERE $__timeFilter(TIME_PARSE(')'`,
+			timeRange: timeRange,
+			want:      `macro $__timeFilter: missing closing parenthesis`,
+		},
+		{
+			name:      "invalid interval",
+			sql:       `SELECT $__timeGroup(__time, 5 minutes) FROM wiki`,
+			timeRange: timeRange,
+			want:      `macro $__timeGroup: invalid interval "5 minutes", expected e.g: 5m, 1h, 1d or PT5M`,
+		},
+		{
+			name: "missing time range",
+			sql:  `SELECT * FROM wiki WHERE $__timeFilter(__time)`,
+			want: `macro $__timeFilter: no time range to filter on`,
+		},
+		{
+			name: "missing time range end",
+			sql:  `SELECT * FROM wiki WHERE __time < $__timeTo()`,
+			timeRange: backend.TimeRange{
+				From: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: `macro $__timeTo: no time range to filter on`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateMacros(tt.sql, tt.timeRange)
+			if err == nil {
+				t.Fatalf("expected an error, got %s", got)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("expected the error %q, got %q", tt.want, err.Error())
+			}
+		})
+	}
+}
+
+func TestInterpolateMacrosTimeGroupWithoutTimeRange(t *testing.T) {
+	// grouping doesn't need a time range
+	got, err := interpolateMacros(`SELECT $__timeGroup(__time, 1h) FROM wiki`, backend.TimeRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT TIME_FLOOR(__time, 'PT1H') FROM wiki`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestISOPeriod(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     string
+	}{
+		{"500ms", "PT0.5S"},
+		{"30s", "PT30S"},
+		{"5m", "PT5M"},
+		{"2h", "PT2H"},
+		{"1d", "P1D"},
+		{"1w", "P1W"},
+		{"1y", "P1Y"},
+		{"PT15M", "PT15M"},
+		{"'1h'", "PT1H"},
+	}
+	for _, tt := range tests {
+		got, err := isoPeriod(tt.interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.interval, tt.want, got)
+		}
+	}
+}
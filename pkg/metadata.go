@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+
+	druiddatasource "github.com/grafadruid/go-druid/builder/datasource"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Druid endpoints listing datasources and lookups, served by brokers
+const (
+	datasourcesEndpoint = "druid/v2/datasources"
+	lookupsEndpoint     = "druid/listen/v1/lookups"
+)
+
+type metadataHandler func(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings) (interface{}, error)
+
+type druidColumnMetadata struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type druidTimeBoundary struct {
+	MinTime string `json:"minTime"`
+	MaxTime string `json:"maxTime"`
+}
+
+// metadataResource returns the handler of a metadata resource path, nil when
+// the path isn't one of them:
+//
+//	datasources                  the names of the Druid datasources
+//	datasources/{name}/columns   the columns of a datasource, with their type
+//	lookups                      the names of the lookups
+//	time-boundary/{name}         the time boundaries of a datasource
+func metadataResource(path string) metadataHandler {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	switch {
+	case len(segments) == 1 && segments[0] == "datasources":
+		return listDatasources
+	case len(segments) == 3 && segments[0] == "datasources" && segments[2] == "columns" && segments[1] != "":
+		return datasourceColumns(segments[1])
+	case len(segments) == 1 && segments[0] == "lookups":
+		return listLookups
+	case len(segments) == 2 && segments[0] == "time-boundary" && segments[1] != "":
+		return datasourceTimeBoundary(segments[1])
+	}
+	return nil
+}
+
+func (ds *druidDatasource) MetadataData(ctx context.Context, req *backend.CallResourceRequest, handler metadataHandler) (interface{}, error) {
+	s, err := ds.settings(req.PluginContext)
+	if err != nil {
+		return nil, err
+	}
+	ctx = s.identity.withIdentity(ctx, resourceHeaders(req.Headers), req.PluginContext.User)
+	return handler(ctx, ds, s)
+}
+
+func listDatasources(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings) (interface{}, error) {
+	names := []string{}
+	if err := ds.getMetadata(ctx, s, datasourcesEndpoint, &names); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func datasourceColumns(name string) metadataHandler {
+	return func(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings) (interface{}, error) {
+		types := s.catalog.columnTypes(ctx, ds, s, name)
+		if types == nil {
+			return nil, errors.New("can't get the columns of datasource " + name)
+		}
+		columns := []druidColumnMetadata{}
+		for n, t := range types {
+			columns = append(columns, druidColumnMetadata{Name: n, Type: t})
+		}
+		sort.Slice(columns, func(i, j int) bool {
+			return columns[i].Name < columns[j].Name
+		})
+		return columns, nil
+	}
+}
+
+func listLookups(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings) (interface{}, error) {
+	var lookups map[string]interface{}
+	if err := ds.getMetadata(ctx, s, lookupsEndpoint, &lookups); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for n := range lookups {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func datasourceTimeBoundary(name string) metadataHandler {
+	return func(ctx context.Context, ds *druidDatasource, s *druidInstanceSettings) (interface{}, error) {
+		q := druidquery.NewTimeBoundary().SetDataSource(druiddatasource.NewTable().SetName(name))
+		var result []struct {
+			Result druidTimeBoundary `json:"result"`
+		}
+		if err := ds.runQuery(ctx, q, s, &result); err != nil {
+			return nil, err
+		}
+		if len(result) == 0 {
+			return druidTimeBoundary{}, nil
+		}
+		return result[0].Result, nil
+	}
+}
+
+func (ds *druidDatasource) getMetadata(ctx context.Context, s *druidInstanceSettings, endpoint string, result interface{}) error {
+	req, err := s.client.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Do(req.WithContext(ctx), result)
+	return err
+}
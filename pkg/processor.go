@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+// queryProcessor holds the query type specific logic: how to access the
+// attributes shared by all queries, how to tune the query before it is sent to
+// Druid and how to turn Druid results into a druidResponse.
+// preProcess returns the query actually sent to Druid.
+type queryProcessor interface {
+	base(q druidquerybuilder.Query) *druidquery.Base
+	preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query
+	postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error
+}
+
+// schemaTypedProcessor is implemented by processors which columns are either
+// datasource columns or outputs declared in the query, so their types can be
+// known upfront rather than guessed from the values.
+type schemaTypedProcessor interface {
+	outputTypes(q druidquerybuilder.Query) map[string]string
+}
+
+var queryProcessors = make(map[string]queryProcessor)
+
+// registerQueryProcessor makes a processor available for the given query type.
+// It is meant to be called from init functions.
+func registerQueryProcessor(queryType string, p queryProcessor) {
+	queryProcessors[queryType] = p
+}
+
+func lookupQueryProcessor(queryType string) (queryProcessor, bool) {
+	p, ok := queryProcessors[queryType]
+	return p, ok
+}
+
+// queryBase gives access to the attributes shared by all query types, nil for
+// query types without processor.
+func queryBase(q druidquerybuilder.Query) *druidquery.Base {
+	p, ok := lookupQueryProcessor(q.Type())
+	if !ok {
+		return nil
+	}
+	return p.base(q)
+}
+
+// decodeResult unmarshals a Druid result keeping numbers as json.Number so that
+// 64 bits integers don't lose precision by going through float64.
+func decodeResult(result json.RawMessage, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(result))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// appendColumns adds the named columns to the response, guessing their type from the rows.
+func appendColumns(r *druidResponse, names []string) {
+	for i, n := range names {
+		col := druidColumn{Name: n}
+		detectColumnType(&col, i, r.Rows)
+		r.Columns = append(r.Columns, col)
+	}
+}
+
+// timestampedResultRows turns results shaped as [{"timestamp": ..., key: {...}}]
+// into rows, the timestamp being the first column.
+func timestampedResultRows(r *druidResponse, results []map[string]interface{}, key string) []string {
+	columns := []string{"timestamp"}
+	for c := range results[0][key].(map[string]interface{}) {
+		columns = append(columns, c)
+	}
+	for _, result := range results {
+		var row []interface{}
+		row = append(row, result["timestamp"])
+		colResults := result[key].(map[string]interface{})
+		for _, c := range columns[1:] {
+			row = append(row, colResults[c])
+		}
+		r.Rows = append(r.Rows, row)
+	}
+	return columns
+}
+
+func detectColumnType(c *druidColumn, pos int, rr [][]interface{}) {
+	t := map[string]int{"nil": 0}
+	for i := 0; i < len(rr); i += int(math.Ceil(float64(len(rr)) / 5.0)) {
+		r := rr[i]
+		switch r[pos].(type) {
+		case string:
+			v := r[pos].(string)
+			_, err := strconv.Atoi(v)
+			if err != nil {
+				_, err := strconv.ParseBool(v)
+				if err != nil {
+					_, err := time.Parse("2006-01-02T15:04:05.000Z", v)
+					if err != nil {
+						t["string"]++
+						continue
+					}
+					t["time"]++
+					continue
+				}
+				t["bool"]++
+				continue
+			}
+			t["int"]++
+			continue
+		case json.Number:
+			if c.Name == "__time" || strings.Contains(strings.ToLower(c.Name), "time_") {
+				t["time"]++
+				continue
+			}
+			if _, err := r[pos].(json.Number).Int64(); err == nil {
+				t["int"]++
+				continue
+			}
+			t["float"]++
+			continue
+		case bool:
+			t["bool"]++
+			continue
+		case []interface{}, map[string]interface{}:
+			t["json"]++
+			continue
+		}
+	}
+	// integers and floats mixed in a same column are floats
+	if t["int"] > 0 && t["float"] > 0 {
+		t["float"] += t["int"]
+		delete(t, "int")
+	}
+	election := func(values map[string]int) string {
+		type kv struct {
+			Key   string
+			Value int
+		}
+		var ss []kv
+		for k, v := range values {
+			ss = append(ss, kv{k, v})
+		}
+		sort.Slice(ss, func(i, j int) bool {
+			return ss[i].Value > ss[j].Value
+		})
+		if len(ss) == 2 {
+			return ss[0].Key
+		}
+		return "string"
+	}
+	c.Type = election(t)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("dataSourceMetadata", &dataSourceMetadataProcessor{})
+}
+
+type dataSourceMetadataProcessor struct{}
+
+func (p *dataSourceMetadataProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.DataSourceMetadata); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *dataSourceMetadataProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *dataSourceMetadataProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var dsm []map[string]interface{}
+	if err := decodeResult(result, &dsm); err != nil {
+		return err
+	}
+	if len(dsm) == 0 {
+		return nil
+	}
+	appendColumns(r, timestampedResultRows(r, dsm, "result"))
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestDataSourceMetadataPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"dataSourceMetadata","dataSource":{"type":"table","name":"wiki"}}`)
+	r := postProcessTestResult(t, q, `[
+		{"timestamp":"2022-01-31T23:59:00.000Z","result":{"maxIngestedEventTime":"2022-01-31T23:59:00.000Z"}}
+	]`, nil)
+	if len(r.Rows) != 1 || len(r.Columns) != 2 {
+		t.Fatalf("expected 1 row of 2 columns, got %v %v", r.Columns, r.Rows)
+	}
+	if c := testColumn(t, r, "maxIngestedEventTime"); r.Rows[0][c] != "2022-01-31T23:59:00.000Z" {
+		t.Errorf("unexpected max ingested event time %v", r.Rows[0][c])
+	}
+}
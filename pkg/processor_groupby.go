@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("groupBy", &groupByProcessor{})
+}
+
+type groupByProcessor struct{}
+
+func (p *groupByProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.GroupBy); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *groupByProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *groupByProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var gb []map[string]interface{}
+	if err := decodeResult(result, &gb); err != nil {
+		return err
+	}
+	if len(gb) == 0 {
+		return nil
+	}
+	appendColumns(r, timestampedResultRows(r, gb, "event"))
+	return nil
+}
+
+func (p *groupByProcessor) outputTypes(q druidquerybuilder.Query) map[string]string {
+	return queryOutputTypes(q)
+}
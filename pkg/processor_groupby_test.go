@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGroupByPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"groupBy","dataSource":{"type":"table","name":"wiki"},"granularity":"all"}`)
+	r := postProcessTestResult(t, q, `[
+		{"version":"v1","timestamp":"2022-01-01T00:00:00.000Z","event":{"country":"France","edits":12}},
+		{"version":"v1","timestamp":"2022-01-01T00:00:00.000Z","event":{"country":"Italy","edits":9007199254740993}}
+	]`, nil)
+	if len(r.Rows) != 2 || len(r.Columns) != 3 {
+		t.Fatalf("expected 2 rows of 3 columns, got %v %v", r.Columns, r.Rows)
+	}
+	country, edits := testColumn(t, r, "country"), testColumn(t, r, "edits")
+	if r.Rows[1][country] != "Italy" {
+		t.Errorf("expected Italy, got %v", r.Rows[1][country])
+	}
+	// 64 bits integers keep their precision
+	if r.Rows[1][edits] != json.Number("9007199254740993") {
+		t.Errorf("expected 9007199254740993 edits, got %v", r.Rows[1][edits])
+	}
+	if r.Columns[edits].Type != "int" {
+		t.Errorf("expected edits to be detected as int, got %s", r.Columns[edits].Type)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("scan", &scanProcessor{})
+}
+
+type scanProcessor struct{}
+
+func (p *scanProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.Scan); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *scanProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	scan := q.(*druidquery.Scan).SetResultFormat("compactedList")
+	if responseLimit, _ := settings["responseLimit"].(float64); responseLimit > 0 && scan.Limit == 0 {
+		// one more row than the limit so that exceeding it can still be reported
+		scan.SetLimit(int64(responseLimit) + 1)
+	}
+	if scan.Order == "" || scan.Order == druidquery.None {
+		// let Druid order rows so that the limit keeps the right ones
+		switch settings["scanTimeOrder"] {
+		case "ascending":
+			scan.SetOrder(druidquery.Ascending)
+		case "descending":
+			scan.SetOrder(druidquery.Descending)
+		}
+	}
+	return scan
+}
+
+func (p *scanProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var scanr []struct {
+		Columns []string        `json:"columns"`
+		Events  [][]interface{} `json:"events"`
+	}
+	if err := decodeResult(result, &scanr); err != nil {
+		return err
+	}
+	if len(scanr) == 0 {
+		return nil
+	}
+	responseLimit, _ := settings["responseLimit"].(float64)
+	// Druid returns a batch per segment, batches columns may differ
+	var columns []string
+	positions := make(map[string]int)
+	for _, batch := range scanr {
+		for _, c := range batch.Columns {
+			if _, ok := positions[c]; !ok {
+				positions[c] = len(columns)
+				columns = append(columns, c)
+			}
+		}
+	}
+	for _, batch := range scanr {
+		for _, e := range batch.Events {
+			row := make([]interface{}, len(columns))
+			for i, c := range batch.Columns {
+				if i < len(e) {
+					row[positions[c]] = e[i]
+				}
+			}
+			r.Rows = append(r.Rows, row)
+		}
+	}
+	if order, _ := settings["scanTimeOrder"].(string); order != "" {
+		if pos, ok := positions["__time"]; ok {
+			sort.SliceStable(r.Rows, func(i, j int) bool {
+				if order == "descending" {
+					return toInt64(r.Rows[i][pos]) > toInt64(r.Rows[j][pos])
+				}
+				return toInt64(r.Rows[i][pos]) < toInt64(r.Rows[j][pos])
+			})
+		}
+	}
+	// the rows of all the batches are sorted before keeping the first ones,
+	// one more than the limit to tell it was exceeded
+	if responseLimit > 0 && len(r.Rows) > int(responseLimit)+1 {
+		r.Rows = r.Rows[:int(responseLimit)+1]
+	}
+	appendColumns(r, columns)
+	return nil
+}
+
+func (p *scanProcessor) outputTypes(q druidquerybuilder.Query) map[string]string {
+	return queryOutputTypes(q)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+const testScanQuery = `{"queryType":"scan","dataSource":{"type":"table","name":"wiki"}}`
+
+func TestScanPreProcess(t *testing.T) {
+	p, _ := lookupQueryProcessor("scan")
+	q := p.preProcess(loadTestQuery(t, testScanQuery), map[string]interface{}{"responseLimit": float64(10), "scanTimeOrder": "descending"})
+	scan := q.(*druidquery.Scan)
+	if scan.ResultFormat != "compactedList" {
+		t.Errorf("expected compacted lists, got %s", scan.ResultFormat)
+	}
+	// one more row than the limit to tell it was exceeded
+	if scan.Limit != 11 {
+		t.Errorf("expected a limit of 11, got %d", scan.Limit)
+	}
+	if scan.Order != druidquery.Descending {
+		t.Errorf("expected a descending order, got %s", scan.Order)
+	}
+}
+
+func TestScanPostProcess(t *testing.T) {
+	q := loadTestQuery(t, testScanQuery)
+	// batches of different segments may have different columns
+	r := postProcessTestResult(t, q, `[
+		{"segmentId":"s1","columns":["__time","page"],"events":[[1640995200000,"a"],[1640995260000,"b"]]},
+		{"segmentId":"s2","columns":["__time","user","page"],"events":[[1640995320000,"jdoe","c"]]}
+	]`, nil)
+	if len(r.Rows) != 3 || len(r.Columns) != 3 {
+		t.Fatalf("expected 3 rows of 3 columns, got %v %v", r.Columns, r.Rows)
+	}
+	page, user := testColumn(t, r, "page"), testColumn(t, r, "user")
+	if r.Rows[0][user] != nil || r.Rows[2][user] != "jdoe" || r.Rows[2][page] != "c" {
+		t.Errorf("unexpected rows %v", r.Rows)
+	}
+	if r.Rows[2][testColumn(t, r, "__time")] != json.Number("1640995320000") {
+		t.Errorf("unexpected time %v", r.Rows[2][0])
+	}
+}
+
+func TestScanPostProcessSortsBeforeLimiting(t *testing.T) {
+	q := loadTestQuery(t, testScanQuery)
+	r := postProcessTestResult(t, q, `[
+		{"segmentId":"s1","columns":["__time","page"],"events":[[1640995200000,"a"],[1640995260000,"b"]]},
+		{"segmentId":"s2","columns":["__time","page"],"events":[[1640995320000,"c"],[1640995380000,"d"]]}
+	]`, map[string]interface{}{"responseLimit": float64(1), "scanTimeOrder": "descending"})
+	// one more row than the limit to tell it was exceeded
+	if len(r.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %v", r.Rows)
+	}
+	page := testColumn(t, r, "page")
+	if r.Rows[0][page] != "d" || r.Rows[1][page] != "c" {
+		t.Errorf("expected the latest rows, got %v", r.Rows)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("search", &searchProcessor{})
+}
+
+type searchProcessor struct{}
+
+func (p *searchProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.Search); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *searchProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *searchProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var s []map[string]interface{}
+	if err := decodeResult(result, &s); err != nil {
+		return err
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	columns := []string{"timestamp"}
+	for c := range s[0]["result"].([]interface{})[0].(map[string]interface{}) {
+		columns = append(columns, c)
+	}
+	for _, result := range s {
+		for _, record := range result["result"].([]interface{}) {
+			var row []interface{}
+			row = append(row, result["timestamp"])
+			o := record.(map[string]interface{})
+			for _, c := range columns[1:] {
+				row = append(row, o[c])
+			}
+			r.Rows = append(r.Rows, row)
+		}
+	}
+	appendColumns(r, columns)
+	return nil
+}
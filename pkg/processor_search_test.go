@@ -0,0 +1,20 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSearchPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"search","dataSource":{"type":"table","name":"wiki"},"granularity":"all","query":{"type":"contains","value":"main"}}`)
+	r := postProcessTestResult(t, q, `[
+		{"timestamp":"2022-01-01T00:00:00.000Z","result":[{"dimension":"page","value":"Main","count":3},{"dimension":"user","value":"Mainly","count":1}]}
+	]`, nil)
+	if len(r.Rows) != 2 || len(r.Columns) != 4 {
+		t.Fatalf("expected 2 rows of 4 columns, got %v %v", r.Columns, r.Rows)
+	}
+	dimension, count := testColumn(t, r, "dimension"), testColumn(t, r, "count")
+	if r.Rows[1][dimension] != "user" || r.Rows[1][count] != json.Number("1") {
+		t.Errorf("unexpected row %v", r.Rows[1])
+	}
+}
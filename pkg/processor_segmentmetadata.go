@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("segmentMetadata", &segmentMetadataProcessor{})
+}
+
+type segmentMetadataProcessor struct{}
+
+func (p *segmentMetadataProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.SegmentMetadata); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *segmentMetadataProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *segmentMetadataProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var sm []map[string]interface{}
+	if err := decodeResult(result, &sm); err != nil {
+		return err
+	}
+	if len(sm) == 0 {
+		return nil
+	}
+	var columns []string
+	view, _ := settings["view"].(string)
+	switch view {
+	case "base":
+		for k, v := range sm[0] {
+			if k != "aggregators" && k != "columns" && k != "timestampSpec" {
+				if k == "intervals" {
+					for i := range v.([]interface{}) {
+						pos := strconv.Itoa(i)
+						columns = append(columns, "interval_start_"+pos)
+						columns = append(columns, "interval_stop_"+pos)
+					}
+				} else {
+					columns = append(columns, k)
+				}
+			}
+		}
+		for _, result := range sm {
+			var row []interface{}
+			for _, c := range columns {
+				var col interface{}
+				if strings.HasPrefix(c, "interval_") {
+					parts := strings.Split(c, "_")
+					pos := 0
+					if parts[1] == "stop" {
+						pos = 1
+					}
+					idx, err := strconv.Atoi(parts[2])
+					if err != nil {
+						return errors.New("interval parsing goes wrong")
+					}
+					ii := result["intervals"].([]interface{})[idx]
+					col = strings.Split(ii.(string), "/")[pos]
+				} else {
+					col = result[c]
+				}
+				row = append(row, col)
+			}
+			r.Rows = append(r.Rows, row)
+		}
+	case "aggregators":
+		for _, v := range sm[0]["aggregators"].(map[string]interface{}) {
+			columns = append(columns, "aggregator")
+			for k := range v.(map[string]interface{}) {
+				columns = append(columns, k)
+			}
+			break
+		}
+		for _, result := range sm {
+			for k, v := range result["aggregators"].(map[string]interface{}) {
+				var row []interface{}
+				for _, c := range columns {
+					var col interface{}
+					if c == "aggregator" {
+						col = k
+					} else {
+						col = v.(map[string]interface{})[c]
+					}
+					row = append(row, col)
+				}
+				r.Rows = append(r.Rows, row)
+			}
+		}
+	case "columns":
+		for _, v := range sm[0]["columns"].(map[string]interface{}) {
+			columns = append(columns, "column")
+			for k := range v.(map[string]interface{}) {
+				columns = append(columns, k)
+			}
+			break
+		}
+		for _, result := range sm {
+			for k, v := range result["columns"].(map[string]interface{}) {
+				var row []interface{}
+				for _, c := range columns {
+					var col interface{}
+					if c == "column" {
+						col = k
+					} else {
+						col = v.(map[string]interface{})[c]
+					}
+					row = append(row, col)
+				}
+				r.Rows = append(r.Rows, row)
+			}
+		}
+	case "timestampspec":
+		for k := range sm[0]["timestampSpec"].(map[string]interface{}) {
+			columns = append(columns, k)
+		}
+		for _, result := range sm {
+			var row []interface{}
+			for _, c := range columns {
+				col := result["timestampSpec"].(map[string]interface{})[c]
+				row = append(row, col)
+			}
+			r.Rows = append(r.Rows, row)
+		}
+	}
+	appendColumns(r, columns)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+const testSegmentMetadataResult = `[{
+	"id":"merged",
+	"intervals":["2022-01-01T00:00:00.000Z/2022-01-02T00:00:00.000Z"],
+	"columns":{
+		"__time":{"type":"LONG","hasMultipleValues":false},
+		"page":{"type":"STRING","hasMultipleValues":false}
+	},
+	"aggregators":{"edits":{"type":"longSum","name":"edits","fieldName":"edits"}},
+	"timestampSpec":{"column":"ts","format":"iso"},
+	"size":0,
+	"numRows":42
+}]`
+
+func TestSegmentMetadataPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"segmentMetadata","dataSource":{"type":"table","name":"wiki"}}`)
+	tests := []struct {
+		view    string
+		rows    int
+		column  string
+		wantRow int
+		want    interface{}
+	}{
+		{view: "base", rows: 1, column: "interval_stop_0", want: "2022-01-02T00:00:00.000Z"},
+		{view: "aggregators", rows: 1, column: "aggregator", want: "edits"},
+		{view: "columns", rows: 2, column: "type"},
+		{view: "timestampspec", rows: 1, column: "format", want: "iso"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view, func(t *testing.T) {
+			r := postProcessTestResult(t, q, testSegmentMetadataResult, map[string]interface{}{"view": tt.view})
+			if len(r.Rows) != tt.rows {
+				t.Fatalf("expected %d rows, got %v", tt.rows, r.Rows)
+			}
+			c := testColumn(t, r, tt.column)
+			if tt.want != nil && r.Rows[tt.wantRow][c] != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, r.Rows[tt.wantRow][c])
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("sql", &sqlProcessor{})
+}
+
+// sqlQuery extends the SQL query with the attributes the Druid client doesn't know about.
+type sqlQuery struct {
+	*druidquery.SQL
+	TypesHeader    bool           `json:"typesHeader"`
+	SQLTypesHeader bool           `json:"sqlTypesHeader"`
+	Parameters     []sqlParameter `json:"parameters,omitempty"`
+}
+
+// sqlParameter is a SQL dynamic parameter, unlike the Druid client ones, its value is typed.
+type sqlParameter struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type sqlProcessor struct{}
+
+func (p *sqlProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	switch qq := q.(type) {
+	case *druidquery.SQL:
+		return &qq.Base
+	case *sqlQuery:
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *sqlProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	sql := q.(*druidquery.SQL)
+	if sql.Context == nil {
+		sql.Context = make(map[string]interface{})
+	}
+	if _, ok := sql.Context["sqlStringifyArrays"]; !ok {
+		// get actual arrays so they are rendered as configured by the arrayHandling setting
+		sql.Context["sqlStringifyArrays"] = false
+	}
+	// parameters were validated when the query was prepared
+	parameters, _ := sqlParameters(settings)
+	for _, p := range sql.Parameters {
+		parameters = append(parameters, sqlParameter{Type: p.Type, Value: p.Value})
+	}
+	return &sqlQuery{
+		SQL:            sql.SetResultFormat("array").SetHeader(true),
+		TypesHeader:    true,
+		SQLTypesHeader: true,
+		Parameters:     parameters,
+	}
+}
+
+func (p *sqlProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var sqlr []interface{}
+	if err := decodeResult(result, &sqlr); err != nil {
+		return err
+	}
+	if len(sqlr) == 0 {
+		return nil
+	}
+	names := sqlr[0].([]interface{})
+	// the header is made of the column names, followed by the native and SQL types rows
+	var nativeTypes, sqlTypes []interface{}
+	headerSize := 1
+	if len(sqlr) > 2 && isTypesRow(sqlr[1], len(names), nativeColumnType) && isTypesRow(sqlr[2], len(names), sqlColumnType) {
+		nativeTypes = sqlr[1].([]interface{})
+		sqlTypes = sqlr[2].([]interface{})
+		headerSize = 3
+	}
+	if len(sqlr) <= headerSize {
+		return nil
+	}
+	for _, row := range sqlr[headerSize:] {
+		r.Rows = append(r.Rows, row.([]interface{}))
+	}
+	for i, c := range names {
+		col := druidColumn{Name: c.(string)}
+		if sqlTypes != nil {
+			col.Type = sqlColumnType(sqlTypes[i])
+			if col.Type == "" {
+				col.Type = nativeColumnType(nativeTypes[i])
+			}
+		}
+		if col.Type == "" {
+			detectColumnType(&col, i, r.Rows)
+		}
+		r.Columns = append(r.Columns, col)
+	}
+	return nil
+}
+
+// isTypesRow tells whether a result row is a types header row, Druid versions
+// not supporting typed headers only sending the column names. All its values
+// must be known type names, so that data rows, even full of nulls, aren't
+// mistaken for it.
+func isTypesRow(row interface{}, size int, columnType func(interface{}) string) bool {
+	values, ok := row.([]interface{})
+	if !ok || len(values) != size {
+		return false
+	}
+	for _, v := range values {
+		if _, ok := v.(string); !ok || columnType(v) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// sqlColumnType maps a Druid SQL type to a column type, empty when unknown.
+func sqlColumnType(typ interface{}) string {
+	t, _ := typ.(string)
+	t = strings.ToUpper(t)
+	if strings.HasPrefix(t, "ARRAY") || strings.HasSuffix(t, " ARRAY") || strings.HasPrefix(t, "COMPLEX") {
+		return "json"
+	}
+	switch t {
+	case "BIGINT", "INTEGER", "SMALLINT", "TINYINT":
+		return "int"
+	case "DOUBLE", "FLOAT", "REAL", "DECIMAL":
+		return "float"
+	case "CHAR", "VARCHAR":
+		return "string"
+	case "TIMESTAMP", "DATE":
+		return "time"
+	case "BOOLEAN":
+		return "bool"
+	case "OTHER":
+		return "json"
+	}
+	return ""
+}
+
+// nativeColumnType maps a Druid native type to a column type, empty when unknown.
+func nativeColumnType(typ interface{}) string {
+	t, _ := typ.(string)
+	t = strings.ToUpper(t)
+	if strings.HasPrefix(t, "ARRAY") || strings.HasPrefix(t, "COMPLEX") {
+		return "json"
+	}
+	switch t {
+	case "LONG":
+		return "int"
+	case "DOUBLE", "FLOAT":
+		return "float"
+	case "STRING":
+		return "string"
+	}
+	return ""
+}
+
+// sqlParameters converts the parameters setting, values of the ? placeholders
+// of the SQL query, to the type they are given. Values of multi-value
+// variables are converted to arrays.
+func sqlParameters(settings map[string]interface{}) ([]sqlParameter, error) {
+	var parameters []sqlParameter
+	settingsParameters, _ := settings["parameters"].([]interface{})
+	for i, p := range settingsParameters {
+		parameter, _ := p.(map[string]interface{})
+		typ, _ := parameter["type"].(string)
+		typ = strings.ToUpper(typ)
+		if typ == "" {
+			typ = "VARCHAR"
+		}
+		values := flattenParameterValue(parameter["value"])
+		if len(values) == 1 && typ != "ARRAY" {
+			v, err := sqlParameterValue(typ, values[0])
+			if err != nil {
+				return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+			}
+			parameters = append(parameters, sqlParameter{Type: typ, Value: v})
+			continue
+		}
+		elements := make([]interface{}, len(values))
+		for j, e := range values {
+			elementType := typ
+			if typ == "ARRAY" {
+				elementType = "VARCHAR"
+			}
+			v, err := sqlParameterValue(elementType, e)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+			}
+			elements[j] = v
+		}
+		parameters = append(parameters, sqlParameter{Type: "ARRAY", Value: elements})
+	}
+	return parameters, nil
+}
+
+// flattenParameterValue returns the values of a parameter, arrays being
+// nested when a multi-value variable is formatted as JSON within an array.
+func flattenParameterValue(v interface{}) []interface{} {
+	a, ok := v.([]interface{})
+	if !ok {
+		return []interface{}{v}
+	}
+	var values []interface{}
+	for _, e := range a {
+		values = append(values, flattenParameterValue(e)...)
+	}
+	return values
+}
+
+func sqlParameterValue(typ string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, isString := v.(string)
+	switch sqlColumnType(typ) {
+	case "int":
+		if isString {
+			i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q", typ, s)
+			}
+			return i, nil
+		}
+		return toInt64(v), nil
+	case "float":
+		if isString {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q", typ, s)
+			}
+			return f, nil
+		}
+		return toFloat64(v), nil
+	case "bool":
+		if isString {
+			b, err := strconv.ParseBool(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q", typ, s)
+			}
+			return b, nil
+		}
+		return toBool(v), nil
+	case "time":
+		// epoch milliseconds, as $__from and $__to, or ISO 8601 dates
+		var t time.Time
+		if !isString {
+			t = time.UnixMilli(toInt64(v))
+		} else if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			t = time.UnixMilli(ms)
+		} else if t, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", typ, s)
+		}
+		return t.UTC().Format(sqlTimestampFormat), nil
+	case "string":
+		if isString {
+			return s, nil
+		}
+		return toJSONString(v), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testSQLQuery = `{"queryType":"sql","query":"SELECT __time, page, edits FROM wiki"}`
+
+func TestSQLPreProcess(t *testing.T) {
+	p, _ := lookupQueryProcessor("sql")
+	q := p.preProcess(loadTestQuery(t, testSQLQuery), map[string]interface{}{
+		"parameters": []interface{}{map[string]interface{}{"type": "VARCHAR", "value": "France"}},
+	})
+	sql := q.(*sqlQuery)
+	if sql.ResultFormat != "array" || sql.Header == nil || !*sql.Header || !sql.TypesHeader || !sql.SQLTypesHeader {
+		t.Errorf("expected typed headers and array results, got %+v", sql)
+	}
+	if sql.Context["sqlStringifyArrays"] != false {
+		t.Errorf("expected arrays not to be stringified, got %v", sql.Context)
+	}
+	if len(sql.Parameters) != 1 || sql.Parameters[0].Value != "France" {
+		t.Errorf("expected the France parameter, got %v", sql.Parameters)
+	}
+}
+
+func TestSQLPostProcess(t *testing.T) {
+	q := loadTestQuery(t, testSQLQuery)
+	r := postProcessTestResult(t, q, `[
+		["__time","page","edits"],
+		["LONG","STRING","LONG"],
+		["TIMESTAMP","VARCHAR","BIGINT"],
+		["2022-01-01T00:00:00.000Z","a",1],
+		["2022-01-01T00:01:00.000Z","b",2]
+	]`, nil)
+	if len(r.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %v", r.Rows)
+	}
+	want := []druidColumn{{"__time", "time"}, {"page", "string"}, {"edits", "int"}}
+	for i, c := range want {
+		if r.Columns[i] != c {
+			t.Errorf("expected column %v, got %v", c, r.Columns[i])
+		}
+	}
+	if r.Rows[1][2] != json.Number("2") {
+		t.Errorf("unexpected row %v", r.Rows[1])
+	}
+}
+
+func TestSQLPostProcessWithoutTypesHeader(t *testing.T) {
+	q := loadTestQuery(t, testSQLQuery)
+	r := postProcessTestResult(t, q, `[
+		["__time","page","edits"],
+		["2022-01-01T00:00:00.000Z","a",1]
+	]`, nil)
+	if len(r.Rows) != 1 {
+		t.Fatalf("expected 1 row, got %v", r.Rows)
+	}
+	if c := r.Columns[testColumn(t, r, "edits")]; c.Type != "int" {
+		t.Errorf("expected edits to be detected as int, got %s", c.Type)
+	}
+}
+
+func TestSQLPostProcessNullRowsWithoutTypesHeader(t *testing.T) {
+	q := loadTestQuery(t, testSQLQuery)
+	// Druid versions ignoring the types headers send data rows right after the names
+	r := postProcessTestResult(t, q, `[
+		["__time","page","edits"],
+		[null,null,null],
+		[null,null,null],
+		["2022-01-01T00:00:00.000Z","a",1]
+	]`, nil)
+	if len(r.Rows) != 3 {
+		t.Errorf("expected the 3 data rows, got %v", r.Rows)
+	}
+}
+
+func TestIsTypesRow(t *testing.T) {
+	tests := []struct {
+		name       string
+		row        interface{}
+		columnType func(interface{}) string
+		want       bool
+	}{
+		{"native types", []interface{}{"LONG", "STRING", "COMPLEX<hyperUnique>"}, nativeColumnType, true},
+		{"SQL types", []interface{}{"TIMESTAMP", "VARCHAR", "BIGINT"}, sqlColumnType, true},
+		{"nulls", []interface{}{nil, nil, nil}, nativeColumnType, false},
+		{"some nulls", []interface{}{"LONG", nil, "STRING"}, nativeColumnType, false},
+		{"data", []interface{}{"a", "b", "c"}, sqlColumnType, false},
+		{"numbers", []interface{}{json.Number("1"), "STRING", "LONG"}, nativeColumnType, false},
+		{"wrong size", []interface{}{"LONG", "STRING"}, nativeColumnType, false},
+		{"not a row", "LONG", nativeColumnType, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTypesRow(tt.row, 3, tt.columnType); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSQLParameters(t *testing.T) {
+	parameter := func(typ string, value interface{}) map[string]interface{} {
+		return map[string]interface{}{"parameters": []interface{}{map[string]interface{}{"type": typ, "value": value}}}
+	}
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     []sqlParameter
+	}{
+		{"no parameters", map[string]interface{}{}, nil},
+		{"varchar by default", map[string]interface{}{"parameters": []interface{}{map[string]interface{}{"value": "France"}}}, []sqlParameter{{"VARCHAR", "France"}}},
+		{"varchar", parameter("varchar", "France"), []sqlParameter{{"VARCHAR", "France"}}},
+		{"char from a number", parameter("CHAR", float64(42)), []sqlParameter{{"CHAR", "42"}}},
+		{"bigint", parameter("BIGINT", " 42 "), []sqlParameter{{"BIGINT", int64(42)}}},
+		{"integer from a number", parameter("INTEGER", float64(42)), []sqlParameter{{"INTEGER", int64(42)}}},
+		{"smallint", parameter("SMALLINT", "7"), []sqlParameter{{"SMALLINT", int64(7)}}},
+		{"tinyint", parameter("TINYINT", "1"), []sqlParameter{{"TINYINT", int64(1)}}},
+		{"double", parameter("DOUBLE", "1.5"), []sqlParameter{{"DOUBLE", 1.5}}},
+		{"float from a number", parameter("FLOAT", float64(2.5)), []sqlParameter{{"FLOAT", 2.5}}},
+		{"real", parameter("REAL", "3"), []sqlParameter{{"REAL", float64(3)}}},
+		{"decimal", parameter("DECIMAL", "0.1"), []sqlParameter{{"DECIMAL", 0.1}}},
+		{"boolean", parameter("BOOLEAN", "true"), []sqlParameter{{"BOOLEAN", true}}},
+		{"boolean from a bool", parameter("BOOLEAN", false), []sqlParameter{{"BOOLEAN", false}}},
+		{"timestamp from epoch milliseconds", parameter("TIMESTAMP", "1640995200000"), []sqlParameter{{"TIMESTAMP", "2022-01-01 00:00:00.000"}}},
+		{"timestamp from a number", parameter("TIMESTAMP", float64(1640995200000)), []sqlParameter{{"TIMESTAMP", "2022-01-01 00:00:00.000"}}},
+		{"date from ISO 8601", parameter("DATE", "2022-01-01T01:00:00+01:00"), []sqlParameter{{"DATE", "2022-01-01 00:00:00.000"}}},
+		{"null", parameter("BIGINT", nil), []sqlParameter{{"BIGINT", nil}}},
+		{"multi-value variable", parameter("VARCHAR", []interface{}{"a", "b"}), []sqlParameter{{"ARRAY", []interface{}{"a", "b"}}}},
+		{"multi-value variable of numbers", parameter("BIGINT", []interface{}{"1", "2"}), []sqlParameter{{"ARRAY", []interface{}{int64(1), int64(2)}}}},
+		{"nested multi-value variable", parameter("VARCHAR", []interface{}{[]interface{}{"a", "b"}, "c"}), []sqlParameter{{"ARRAY", []interface{}{"a", "b", "c"}}}},
+		{"array of a single value", parameter("ARRAY", "a"), []sqlParameter{{"ARRAY", []interface{}{"a"}}}},
+		{"array of numbers as strings", parameter("ARRAY", []interface{}{float64(1), "b"}), []sqlParameter{{"ARRAY", []interface{}{"1", "b"}}}},
+		{
+			"several parameters",
+			map[string]interface{}{"parameters": []interface{}{
+				map[string]interface{}{"type": "VARCHAR", "value": "France"},
+				map[string]interface{}{"type": "BIGINT", "value": "10"},
+			}},
+			[]sqlParameter{{"VARCHAR", "France"}, {"BIGINT", int64(10)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqlParameters(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSQLParametersErrors(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value interface{}
+		want  string
+	}{
+		{"BIGINT", "ten", `parameter 2: invalid BIGINT value "ten"`},
+		{"INTEGER", "1.5", `parameter 2: invalid INTEGER value "1.5"`},
+		{"DOUBLE", "one", `parameter 2: invalid DOUBLE value "one"`},
+		{"BOOLEAN", "yes", `parameter 2: invalid BOOLEAN value "yes"`},
+		{"TIMESTAMP", "yesterday", `parameter 2: invalid TIMESTAMP value "yesterday"`},
+		{"BIGINT", []interface{}{"1", "two"}, `parameter 2: invalid BIGINT value "two"`},
+		{"GEOMETRY", "a", `parameter 2: unsupported type GEOMETRY`},
+	}
+	for _, tt := range tests {
+		settings := map[string]interface{}{"parameters": []interface{}{
+			map[string]interface{}{"type": "VARCHAR", "value": "France"},
+			map[string]interface{}{"type": tt.typ, "value": tt.value},
+		}}
+		_, err := sqlParameters(settings)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s %v: expected the error %q, got %v", tt.typ, tt.value, tt.want, err)
+		}
+	}
+}
+
+func TestSQLPreProcessMergesParameters(t *testing.T) {
+	p, _ := lookupQueryProcessor("sql")
+	q := loadTestQuery(t, `{"queryType":"sql","query":"SELECT page FROM wiki WHERE countryName = ? AND page = ?","parameters":[{"type":"VARCHAR","value":"Main"}]}`)
+	sql := p.preProcess(q, map[string]interface{}{
+		"parameters": []interface{}{map[string]interface{}{"type": "VARCHAR", "value": "France"}},
+	}).(*sqlQuery)
+	// the parameters setting comes first, then the builder ones
+	want := []sqlParameter{{"VARCHAR", "France"}, {"VARCHAR", "Main"}}
+	if !reflect.DeepEqual(sql.Parameters, want) {
+		t.Errorf("expected %v, got %v", want, sql.Parameters)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func loadTestQuery(t *testing.T, q string) druidquerybuilder.Query {
+	t.Helper()
+	query, err := druidquery.Load([]byte(q))
+	if err != nil {
+		t.Fatalf("can't load query %s: %v", q, err)
+	}
+	return query
+}
+
+// postProcessTestResult runs the processor of a query over a Druid result.
+func postProcessTestResult(t *testing.T, q druidquerybuilder.Query, result string, settings map[string]interface{}) *druidResponse {
+	t.Helper()
+	p, ok := lookupQueryProcessor(q.Type())
+	if !ok {
+		t.Fatalf("no processor for %s", q.Type())
+	}
+	r := &druidResponse{}
+	if err := p.postProcess(q, json.RawMessage(result), r, settings); err != nil {
+		t.Fatalf("post process failed: %v", err)
+	}
+	return r
+}
+
+// testColumn returns the position of a response column, columns order being
+// unspecified for the results made of JSON objects.
+func testColumn(t *testing.T, r *druidResponse, name string) int {
+	t.Helper()
+	for i, c := range r.Columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	t.Fatalf("no column %s in %v", name, r.Columns)
+	return -1
+}
+
+func TestQueryBase(t *testing.T) {
+	queries := []string{
+		`{"queryType":"dataSourceMetadata","dataSource":{"type":"table","name":"wiki"}}`,
+		`{"queryType":"groupBy","dataSource":{"type":"table","name":"wiki"},"granularity":"all"}`,
+		`{"queryType":"scan","dataSource":{"type":"table","name":"wiki"}}`,
+		`{"queryType":"search","dataSource":{"type":"table","name":"wiki"},"granularity":"all","query":{"type":"contains","value":"main"}}`,
+		`{"queryType":"segmentMetadata","dataSource":{"type":"table","name":"wiki"}}`,
+		`{"queryType":"sql","query":"SELECT 1"}`,
+		`{"queryType":"timeBoundary","dataSource":{"type":"table","name":"wiki"}}`,
+		`{"queryType":"timeseries","dataSource":{"type":"table","name":"wiki"},"granularity":"all"}`,
+		`{"queryType":"topN","dataSource":{"type":"table","name":"wiki"},"granularity":"all","dimension":{"type":"default","dimension":"page","outputName":"page"},"metric":{"type":"numeric","metric":"edits"},"threshold":10}`,
+	}
+	for _, query := range queries {
+		q := loadTestQuery(t, query)
+		base := queryBase(q)
+		if base == nil {
+			t.Errorf("%s: no base", q.Type())
+			continue
+		}
+		base.SetContext(map[string]interface{}{"queryId": "abc"})
+		b, _ := json.Marshal(q)
+		var sent map[string]interface{}
+		json.Unmarshal(b, &sent)
+		if ctx, _ := sent["context"].(map[string]interface{}); ctx["queryId"] != "abc" {
+			t.Errorf("%s: context not set through the base: %s", q.Type(), b)
+		}
+	}
+	if p, ok := lookupQueryProcessor("timeseries"); !ok || p.base(loadTestQuery(t, queries[1])) != nil {
+		t.Errorf("a processor gave the base of another query type")
+	}
+}
+
+func TestSQLQueryBase(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"sql","query":"SELECT 1"}`)
+	p, _ := lookupQueryProcessor("sql")
+	sent := p.preProcess(q, map[string]interface{}{})
+	if _, ok := sent.(*sqlQuery); !ok {
+		t.Fatalf("expected the preprocessed query to be a sqlQuery, got %T", sent)
+	}
+	if queryBase(sent) == nil {
+		t.Errorf("no base for the preprocessed SQL query")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("timeBoundary", &timeBoundaryProcessor{})
+}
+
+type timeBoundaryProcessor struct{}
+
+func (p *timeBoundaryProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.TimeBoundary); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *timeBoundaryProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *timeBoundaryProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var tb []map[string]interface{}
+	if err := decodeResult(result, &tb); err != nil {
+		return err
+	}
+	if len(tb) == 0 {
+		return nil
+	}
+	appendColumns(r, timestampedResultRows(r, tb, "result"))
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestTimeBoundaryPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"timeBoundary","dataSource":{"type":"table","name":"wiki"}}`)
+	r := postProcessTestResult(t, q, `[
+		{"timestamp":"2022-01-01T00:00:00.000Z","result":{"minTime":"2022-01-01T00:00:00.000Z","maxTime":"2022-01-31T23:59:00.000Z"}}
+	]`, nil)
+	if len(r.Rows) != 1 || len(r.Columns) != 3 {
+		t.Fatalf("expected 1 row of 3 columns, got %v %v", r.Columns, r.Rows)
+	}
+	maxTime := testColumn(t, r, "maxTime")
+	if r.Rows[0][maxTime] != "2022-01-31T23:59:00.000Z" {
+		t.Errorf("unexpected max time %v", r.Rows[0][maxTime])
+	}
+	if r.Columns[maxTime].Type != "time" {
+		t.Errorf("expected max time to be detected as time, got %s", r.Columns[maxTime].Type)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("timeseries", &timeseriesProcessor{})
+}
+
+type timeseriesProcessor struct{}
+
+func (p *timeseriesProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.Timeseries); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *timeseriesProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *timeseriesProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var tsr []map[string]interface{}
+	if err := decodeResult(result, &tsr); err != nil {
+		return err
+	}
+	if len(tsr) == 0 {
+		return nil
+	}
+	columns := []string{"timestamp"}
+	for c := range tsr[0]["result"].(map[string]interface{}) {
+		columns = append(columns, c)
+	}
+	for _, result := range tsr {
+		var row []interface{}
+		t := result["timestamp"]
+		if t == nil {
+			// grand total, lets keep it last
+			t = r.Rows[len(r.Rows)-1][0]
+		}
+		row = append(row, t)
+		colResults := result["result"].(map[string]interface{})
+		for _, c := range columns[1:] {
+			row = append(row, colResults[c])
+		}
+		r.Rows = append(r.Rows, row)
+	}
+	appendColumns(r, columns)
+	return nil
+}
+
+func (p *timeseriesProcessor) outputTypes(q druidquerybuilder.Query) map[string]string {
+	return queryOutputTypes(q)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTimeseriesPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"timeseries","dataSource":{"type":"table","name":"wiki"},"granularity":"all"}`)
+	r := postProcessTestResult(t, q, `[
+		{"timestamp":"2022-01-01T00:00:00.000Z","result":{"edits":10,"delta":1.5}},
+		{"timestamp":"2022-01-01T01:00:00.000Z","result":{"edits":20,"delta":2.5}},
+		{"timestamp":null,"result":{"edits":30,"delta":4}}
+	]`, nil)
+	if len(r.Rows) != 3 || len(r.Columns) != 3 {
+		t.Fatalf("expected 3 rows of 3 columns, got %v %v", r.Columns, r.Rows)
+	}
+	if r.Columns[0].Name != "timestamp" {
+		t.Errorf("expected the timestamp first, got %v", r.Columns)
+	}
+	edits := testColumn(t, r, "edits")
+	if r.Rows[1][edits] != json.Number("20") {
+		t.Errorf("expected 20 edits, got %v", r.Rows[1][edits])
+	}
+	// the grand total row gets the timestamp of the last row
+	if r.Rows[2][0] != "2022-01-01T01:00:00.000Z" || r.Rows[2][edits] != json.Number("30") {
+		t.Errorf("unexpected grand total row %v", r.Rows[2])
+	}
+}
+
+func TestTimeseriesPostProcessEmpty(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"timeseries","dataSource":{"type":"table","name":"wiki"},"granularity":"all"}`)
+	if r := postProcessTestResult(t, q, `[]`, nil); len(r.Rows) != 0 || len(r.Columns) != 0 {
+		t.Errorf("expected an empty response, got %v %v", r.Columns, r.Rows)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+
+	druidquerybuilder "github.com/grafadruid/go-druid/builder"
+	druidquery "github.com/grafadruid/go-druid/builder/query"
+)
+
+func init() {
+	registerQueryProcessor("topN", &topNProcessor{})
+}
+
+type topNProcessor struct{}
+
+func (p *topNProcessor) base(q druidquerybuilder.Query) *druidquery.Base {
+	if qq, ok := q.(*druidquery.TopN); ok {
+		return &qq.Base
+	}
+	return nil
+}
+
+func (p *topNProcessor) preProcess(q druidquerybuilder.Query, settings map[string]interface{}) druidquerybuilder.Query {
+	return q
+}
+
+func (p *topNProcessor) postProcess(q druidquerybuilder.Query, result json.RawMessage, r *druidResponse, settings map[string]interface{}) error {
+	var tn []map[string]interface{}
+	if err := decodeResult(result, &tn); err != nil {
+		return err
+	}
+	var columns []string
+	for _, result := range tn {
+		if columns == nil && len(result["result"].([]interface{})) > 0 {
+			columns = append(columns, "timestamp")
+			for c := range result["result"].([]interface{})[0].(map[string]interface{}) {
+				columns = append(columns, c)
+			}
+		}
+		for _, record := range result["result"].([]interface{}) {
+			var row []interface{}
+			row = append(row, result["timestamp"])
+			o, ok := record.(map[string]interface{})
+			if ok {
+				for _, c := range columns[1:] {
+					row = append(row, o[c])
+				}
+				r.Rows = append(r.Rows, row)
+			}
+		}
+	}
+	appendColumns(r, columns)
+	return nil
+}
+
+func (p *topNProcessor) outputTypes(q druidquerybuilder.Query) map[string]string {
+	return queryOutputTypes(q)
+}
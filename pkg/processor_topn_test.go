@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTopNPostProcess(t *testing.T) {
+	q := loadTestQuery(t, `{"queryType":"topN","dataSource":{"type":"table","name":"wiki"},"granularity":"all","dimension":{"type":"default","dimension":"page","outputName":"page"},"metric":{"type":"numeric","metric":"edits"},"threshold":10}`)
+	r := postProcessTestResult(t, q, `[
+		{"timestamp":"2022-01-01T00:00:00.000Z","result":[{"page":"a","edits":3},{"page":"b","edits":2}]},
+		{"timestamp":"2022-01-02T00:00:00.000Z","result":[]},
+		{"timestamp":"2022-01-03T00:00:00.000Z","result":[{"page":"c","edits":1}]}
+	]`, nil)
+	if len(r.Rows) != 3 || len(r.Columns) != 3 {
+		t.Fatalf("expected 3 rows of 3 columns, got %v %v", r.Columns, r.Rows)
+	}
+	page, edits := testColumn(t, r, "page"), testColumn(t, r, "edits")
+	if r.Rows[2][0] != "2022-01-03T00:00:00.000Z" || r.Rows[2][page] != "c" || r.Rows[2][edits] != json.Number("1") {
+		t.Errorf("unexpected row %v", r.Rows[2])
+	}
+}
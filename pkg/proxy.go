@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// Environment variables Grafana sets up for plugins when its secure socks proxy is enabled
+const (
+	secureSocksProxyEnabledEnv       = "GF_SECURE_SOCKS_DATASOURCE_PROXY_SERVER_ENABLED"
+	secureSocksProxyAddressEnv       = "GF_SECURE_SOCKS_DATASOURCE_PROXY_PROXY_ADDRESS"
+	secureSocksProxyServerNameEnv    = "GF_SECURE_SOCKS_DATASOURCE_PROXY_SERVER_NAME"
+	secureSocksProxyClientCertEnv    = "GF_SECURE_SOCKS_DATASOURCE_PROXY_CLIENT_CERT"
+	secureSocksProxyClientKeyEnv     = "GF_SECURE_SOCKS_DATASOURCE_PROXY_CLIENT_KEY"
+	secureSocksProxyRootCACertEnv    = "GF_SECURE_SOCKS_DATASOURCE_PROXY_ROOT_CA_CERT"
+	secureSocksProxyAllowInsecureEnv = "GF_SECURE_SOCKS_DATASOURCE_PROXY_ALLOW_INSECURE"
+)
+
+// withProxy sets the transport up to reach Druid through a proxy: the Grafana
+// secure socks proxy when enabled for the datasource, else the proxy of the
+// connection settings, if any, except for the hosts it excludes.
+func withProxy(transport *http.Transport, data *simplejson.Json, secureData map[string]string, uid string) error {
+	if data.Get("enableSecureSocksProxy").MustBool() && os.Getenv(secureSocksProxyEnabledEnv) == "true" {
+		dialer, err := secureSocksProxyDialer(data.Get("secureSocksProxyUsername").MustString(uid))
+		if err != nil {
+			return fmt.Errorf("can't set Grafana secure socks proxy up: %w", err)
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		return nil
+	}
+	proxyURL := strings.TrimSpace(data.Get("connection.proxyUrl").MustString())
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL %s: %w", proxyURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid proxy URL %s: scheme must be http, https or socks5", proxyURL)
+	}
+	if user := data.Get("connection.proxyUser").MustString(); user != "" {
+		u.User = url.UserPassword(user, secureData["connection.proxyPassword"])
+	}
+	config := &httpproxy.Config{
+		HTTPProxy:  u.String(),
+		HTTPSProxy: u.String(),
+		NoProxy:    data.Get("connection.noProxy").MustString(),
+	}
+	proxyFunc := config.ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	return nil
+}
+
+// secureSocksProxyDialer returns a dialer connecting through the Grafana
+// secure socks proxy, authenticating with TLS client certificates.
+func secureSocksProxyDialer(user string) (proxy.ContextDialer, error) {
+	address := os.Getenv(secureSocksProxyAddressEnv)
+	if address == "" {
+		return nil, fmt.Errorf("%s is not set", secureSocksProxyAddressEnv)
+	}
+	var forward proxy.Dialer = &net.Dialer{}
+	if os.Getenv(secureSocksProxyAllowInsecureEnv) != "true" {
+		config, err := secureSocksProxyTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		forward = &tlsDialer{config: config}
+	}
+	// the user lets the proxy tell the datasources apart
+	dialer, err := proxy.SOCKS5("tcp", address, &proxy.Auth{User: user}, forward)
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("socks dialer can't dial with a context")
+	}
+	return contextDialer, nil
+}
+
+func secureSocksProxyTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(os.Getenv(secureSocksProxyClientCertEnv), os.Getenv(secureSocksProxyClientKeyEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secure socks proxy client certificate and key: %w", err)
+	}
+	rootCAs := x509.NewCertPool()
+	for _, path := range strings.Fields(os.Getenv(secureSocksProxyRootCACertEnv)) {
+		ca, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secure socks proxy CA certificate: %w", err)
+		}
+		if !rootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to append secure socks proxy CA certificate %s", path)
+		}
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		ServerName:   os.Getenv(secureSocksProxyServerNameEnv),
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// tlsDialer dials TLS connections.
+type tlsDialer struct {
+	config *tls.Config
+}
+
+func (d *tlsDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *tlsDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &tls.Dialer{Config: d.config}
+	return dialer.DialContext(ctx, network, address)
+}
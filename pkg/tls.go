@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// TLS versions the connection to Druid can be restricted to, at least
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTransport returns the transport of the requests to Druid, which all the
+// connection options compose on.
+func newTransport(data *simplejson.Json, secureData map[string]string, uid string) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(data, secureData)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if err := withProxy(transport, data, secureData, uid); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// newTLSConfig returns the TLS configuration of the connection to Druid:
+// verification of the server against the system CAs and/or a custom CA unless
+// skipped, client certificate when mTLS is enabled, server name override and
+// protocol constraints. The custom CA applies when enabled or with mTLS, as
+// it used to apply with mTLS only.
+func newTLSConfig(data *simplejson.Json, secureData map[string]string) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: data.Get("connection.skipTls").MustBool(),
+		ServerName:         data.Get("connection.tlsServerName").MustString(),
+	}
+
+	mTLS := data.Get("connection.mTLS").MustBool()
+	customCA := mTLS || data.Get("connection.tlsCustomCa").MustBool()
+	// without custom CA, the system CA pool is used
+	if ca := secureData["connection.mTLSCa"]; customCA && ca != "" {
+		pool := x509.NewCertPool()
+		if data.Get("connection.mTLSUseSystemCaPool").MustBool() {
+			log.DefaultLogger.Info("Using system CA pool and custom CA for Druid connection")
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load system CA pool: %w", err)
+			}
+			pool = systemPool
+		} else {
+			log.DefaultLogger.Info("Using custom CA for Druid connection")
+		}
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, fmt.Errorf("failed to append CA certificate: %s", ca)
+		}
+		config.RootCAs = pool
+	}
+
+	if mTLS {
+		log.DefaultLogger.Info("mTLS enabled for Druid connection")
+		cert := secureData["connection.mTLSCert"]
+		if cert == "" {
+			return nil, fmt.Errorf("mTLS certificate is required but not provided")
+		}
+		key := secureData["connection.mTLSKey"]
+		if key == "" {
+			return nil, fmt.Errorf("mTLS key is required but not provided")
+		}
+		clientCert, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate and key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{clientCert}
+	}
+
+	if version := data.Get("connection.tlsMinVersion").MustString(); version != "" {
+		v, ok := tlsVersions[version]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version: %s", version)
+		}
+		config.MinVersion = v
+	}
+
+	if names := data.Get("connection.tlsCipherSuites").MustStringArray(); len(names) > 0 {
+		suites := make(map[string]uint16)
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range names {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unsupported TLS cipher suite: %s", name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+	return config, nil
+}
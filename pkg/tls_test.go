@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+)
+
+// testCertificate returns a certificate in PEM, along with its key, signed by
+// the given parent, self-signed when nil.
+func testCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	ca, caKey, caPEM, _ := testCertificate(t, "Test CA", nil, nil)
+	client, _, certPEM, keyPEM := testCertificate(t, "grafana", ca, caKey)
+	_, _, otherCertPEM, _ := testCertificate(t, "other", ca, caKey)
+
+	// trustsCA tells whether certificates signed by the test CA are trusted
+	trustsCA := func(config *tls.Config) bool {
+		_, err := client.Verify(x509.VerifyOptions{Roots: config.RootCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		return config.RootCAs != nil && err == nil
+	}
+	tests := []struct {
+		name   string
+		data   string
+		secure map[string]string
+		check  func(t *testing.T, config *tls.Config)
+		err    bool
+	}{
+		{
+			name: "defaults",
+			data: `{}`,
+			check: func(t *testing.T, config *tls.Config) {
+				if config.InsecureSkipVerify || config.RootCAs != nil || len(config.Certificates) > 0 || config.MinVersion != 0 || config.CipherSuites != nil {
+					t.Errorf("expected the default configuration, got %+v", config)
+				}
+			},
+		},
+		{
+			name: "skip verify",
+			data: `{"connection.skipTls":true}`,
+			check: func(t *testing.T, config *tls.Config) {
+				if !config.InsecureSkipVerify {
+					t.Error("expected the verification to be skipped")
+				}
+			},
+		},
+		{
+			name:   "custom CA",
+			data:   `{"connection.tlsCustomCa":true}`,
+			secure: map[string]string{"connection.mTLSCa": caPEM},
+			check: func(t *testing.T, config *tls.Config) {
+				if !trustsCA(config) || len(config.Certificates) > 0 {
+					t.Error("expected the custom CA to be trusted, without client certificate")
+				}
+			},
+		},
+		{
+			name:   "custom CA disabled",
+			data:   `{}`,
+			secure: map[string]string{"connection.mTLSCa": caPEM},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.RootCAs != nil {
+					t.Error("expected the system CA pool")
+				}
+			},
+		},
+		{
+			name:   "custom CA and system pool",
+			data:   `{"connection.tlsCustomCa":true,"connection.mTLSUseSystemCaPool":true}`,
+			secure: map[string]string{"connection.mTLSCa": caPEM},
+			check: func(t *testing.T, config *tls.Config) {
+				if !trustsCA(config) {
+					t.Error("expected the custom CA to be trusted")
+				}
+			},
+		},
+		{
+			name:   "mTLS with CA",
+			data:   `{"connection.mTLS":true}`,
+			secure: map[string]string{"connection.mTLSCa": caPEM, "connection.mTLSCert": certPEM, "connection.mTLSKey": keyPEM},
+			check: func(t *testing.T, config *tls.Config) {
+				if !trustsCA(config) || len(config.Certificates) != 1 {
+					t.Error("expected the custom CA to be trusted, with a client certificate")
+				}
+			},
+		},
+		{
+			name:   "mTLS without CA",
+			data:   `{"connection.mTLS":true}`,
+			secure: map[string]string{"connection.mTLSCert": certPEM, "connection.mTLSKey": keyPEM},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.RootCAs != nil || len(config.Certificates) != 1 {
+					t.Error("expected the system CA pool, with a client certificate")
+				}
+			},
+		},
+		{
+			name: "server name",
+			data: `{"connection.tlsServerName":"druid.example.com"}`,
+			check: func(t *testing.T, config *tls.Config) {
+				if config.ServerName != "druid.example.com" {
+					t.Errorf("expected the server name druid.example.com, got %s", config.ServerName)
+				}
+			},
+		},
+		{
+			name: "minimum version",
+			data: `{"connection.tlsMinVersion":"1.2"}`,
+			check: func(t *testing.T, config *tls.Config) {
+				if config.MinVersion != tls.VersionTLS12 {
+					t.Errorf("expected TLS 1.2 at least, got %x", config.MinVersion)
+				}
+			},
+		},
+		{
+			name: "cipher suites",
+			data: `{"connection.tlsCipherSuites":["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256","TLS_RSA_WITH_AES_128_CBC_SHA"]}`,
+			check: func(t *testing.T, config *tls.Config) {
+				if len(config.CipherSuites) != 2 || config.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || config.CipherSuites[1] != tls.TLS_RSA_WITH_AES_128_CBC_SHA {
+					t.Errorf("unexpected cipher suites %v", config.CipherSuites)
+				}
+			},
+		},
+		{
+			name:   "invalid CA",
+			data:   `{"connection.tlsCustomCa":true}`,
+			secure: map[string]string{"connection.mTLSCa": "not a certificate"},
+			err:    true,
+		},
+		{
+			name:   "invalid CA with system pool",
+			data:   `{"connection.tlsCustomCa":true,"connection.mTLSUseSystemCaPool":true}`,
+			secure: map[string]string{"connection.mTLSCa": "not a certificate"},
+			err:    true,
+		},
+		{
+			name:   "invalid client certificate",
+			data:   `{"connection.mTLS":true}`,
+			secure: map[string]string{"connection.mTLSCert": "not a certificate", "connection.mTLSKey": keyPEM},
+			err:    true,
+		},
+		{
+			name:   "client certificate not matching the key",
+			data:   `{"connection.mTLS":true}`,
+			secure: map[string]string{"connection.mTLSCert": otherCertPEM, "connection.mTLSKey": keyPEM},
+			err:    true,
+		},
+		{
+			name:   "missing client certificate",
+			data:   `{"connection.mTLS":true}`,
+			secure: map[string]string{"connection.mTLSKey": keyPEM},
+			err:    true,
+		},
+		{
+			name:   "missing client key",
+			data:   `{"connection.mTLS":true}`,
+			secure: map[string]string{"connection.mTLSCert": certPEM},
+			err:    true,
+		},
+		{
+			name: "unsupported minimum version",
+			data: `{"connection.tlsMinVersion":"1.4"}`,
+			err:  true,
+		},
+		{
+			name: "unsupported cipher suite",
+			data: `{"connection.tlsCipherSuites":["TLS_NOT_A_SUITE"]}`,
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := simplejson.NewJson([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := newTLSConfig(data, tt.secure)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
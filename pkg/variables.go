@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Template variables references: ${name}, ${name:format}, [[name]], [[name:format]] and $name.
+// The druid:json format references are quoted in the query JSON and replaced by a JSON value.
+var (
+	templateVariableRegexp     = regexp.MustCompile(`\$\{(\w+)(?::([\w:]+))?\}|\[\[(\w+)(?::([\w:]+))?\]\]|\$(\w+)`)
+	jsonTemplateVariableRegexp = regexp.MustCompile(`"(?:\$\{(\w+):druid:json\}|\[\[(\w+):druid:json\]\])"`)
+)
+
+const defaultTimezone = "UTC"
+
+// interpolateTemplateVariables replaces the template variables of a query
+// which the frontend didn't replace, which is the case of queries evaluated by
+// Grafana backend such as alert rules: the time range variables $__from,
+// $__to, $__timezone, and the constant variables defined in the query JSON:
+//
+//	{"builder": {...}, "settings": {...}, "variables": {"country": "France", "pages": ["a", "b"]}}
+//
+// $__timezone is UTC unless a __timezone constant variable is defined.
+// Unknown variables are left as is.
+func interpolateTemplateVariables(expr string, timeRange backend.TimeRange) string {
+	var q struct {
+		Variables map[string]interface{} `json:"variables"`
+	}
+	_ = json.Unmarshal([]byte(expr), &q)
+	variable := func(name string) (interface{}, bool) {
+		if v, ok := q.Variables[name]; ok {
+			return v, true
+		}
+		switch name {
+		case "__from":
+			return timeRange.From, !timeRange.From.IsZero()
+		case "__to":
+			return timeRange.To, !timeRange.To.IsZero()
+		case "__timezone":
+			return defaultTimezone, true
+		}
+		return nil, false
+	}
+	expr = jsonTemplateVariableRegexp.ReplaceAllStringFunc(expr, func(match string) string {
+		m := jsonTemplateVariableRegexp.FindStringSubmatch(match)
+		v, ok := variable(m[1] + m[2])
+		if !ok {
+			return match
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return match
+		}
+		return string(b)
+	})
+	return templateVariableRegexp.ReplaceAllStringFunc(expr, func(match string) string {
+		m := templateVariableRegexp.FindStringSubmatch(match)
+		v, ok := variable(m[1] + m[3] + m[5])
+		if !ok {
+			return match
+		}
+		// the reference is within a JSON string
+		b, _ := json.Marshal(formatTemplateVariable(v, m[2]+m[4]))
+		return string(b[1 : len(b)-1])
+	})
+}
+
+// formatTemplateVariable formats a variable value the way Grafana does,
+// multi-value variables being comma separated unless told otherwise.
+func formatTemplateVariable(v interface{}, format string) string {
+	if t, ok := v.(time.Time); ok {
+		switch format {
+		case "date", "date:iso":
+			return t.UTC().Format("2006-01-02T15:04:05.000Z")
+		case "date:seconds":
+			return strconv.FormatInt(t.Unix(), 10)
+		default:
+			return strconv.FormatInt(t.UnixMilli(), 10)
+		}
+	}
+	values, ok := v.([]interface{})
+	if !ok {
+		values = []interface{}{v}
+	}
+	elements := make([]string, len(values))
+	for i, e := range values {
+		elements[i] = fmt.Sprint(e)
+		if s, ok := e.(string); ok {
+			elements[i] = s
+		}
+	}
+	switch format {
+	case "json":
+		return toJSONString(v)
+	case "pipe":
+		return strings.Join(elements, "|")
+	case "doublequote":
+		for i, e := range elements {
+			elements[i] = `"` + strings.ReplaceAll(e, `"`, `\"`) + `"`
+		}
+	case "singlequote":
+		for i, e := range elements {
+			elements[i] = "'" + strings.ReplaceAll(e, "'", `\'`) + "'"
+		}
+	case "sqlstring":
+		for i, e := range elements {
+			elements[i] = "'" + strings.ReplaceAll(e, "'", "''") + "'"
+		}
+	}
+	return strings.Join(elements, ",")
+}
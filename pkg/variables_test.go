@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestInterpolateTemplateVariables(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2022, 1, 2, 12, 30, 0, 0, time.FixedZone("CET", 3600)),
+	}
+	variables := `"variables": {"country": "France", "pages": ["a", "b'c"], "count": 3, "quoted": "say \"hi\""}`
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"from", `{"from": "$__from"}`, `{"from": "1640995200000"}`},
+		{"to", `{"to": "${__to}"}`, `{"to": "1641123000000"}`},
+		{"from iso", `{"from": "${__from:date:iso}"}`, `{"from": "2022-01-01T00:00:00.000Z"}`},
+		{"to iso in UTC", `{"to": "${__to:date}"}`, `{"to": "2022-01-02T11:30:00.000Z"}`},
+		{"from seconds", `{"from": "${__from:date:seconds}"}`, `{"from": "1640995200"}`},
+		{"legacy syntax", `{"from": "[[__from:date:seconds]]"}`, `{"from": "1640995200"}`},
+		{"timezone", `{"tz": "$__timezone"}`, `{"tz": "UTC"}`},
+		{"timezone constant", `{"tz": "$__timezone", "variables": {"__timezone": "Europe/Paris"}}`, `{"tz": "Europe/Paris", "variables": {"__timezone": "Europe/Paris"}}`},
+		{"constant", `{"q": "$country", ` + variables + `}`, `{"q": "France", ` + variables + `}`},
+		{"number constant", `{"q": "${count}", ` + variables + `}`, `{"q": "3", ` + variables + `}`},
+		{"quotes escaped", `{"q": "$quoted", ` + variables + `}`, `{"q": "say \"hi\"", ` + variables + `}`},
+		{"multi-value", `{"q": "$pages", ` + variables + `}`, `{"q": "a,b'c", ` + variables + `}`},
+		{"csv", `{"q": "${pages:csv}", ` + variables + `}`, `{"q": "a,b'c", ` + variables + `}`},
+		{"pipe", `{"q": "${pages:pipe}", ` + variables + `}`, `{"q": "a|b'c", ` + variables + `}`},
+		{"doublequote", `{"q": "${pages:doublequote}", ` + variables + `}`, `{"q": "\"a\",\"b'c\"", ` + variables + `}`},
+		{"singlequote", `{"q": "${pages:singlequote}", ` + variables + `}`, `{"q": "'a','b\\'c'", ` + variables + `}`},
+		{"sqlstring", `{"q": "${pages:sqlstring}", ` + variables + `}`, `{"q": "'a','b''c'", ` + variables + `}`},
+		{"json", `{"q": "${pages:json}", ` + variables + `}`, `{"q": "[\"a\",\"b'c\"]", ` + variables + `}`},
+		{"druid:json", `{"q": "${pages:druid:json}", ` + variables + `}`, `{"q": ["a","b'c"], ` + variables + `}`},
+		{"druid:json legacy syntax", `{"q": "[[country:druid:json]]", ` + variables + `}`, `{"q": "France", ` + variables + `}`},
+		{"unknown", `{"q": "$unknown ${unknown:csv} [[unknown]]"}`, `{"q": "$unknown ${unknown:csv} [[unknown]]"}`},
+		{"unknown druid:json", `{"q": "${unknown:druid:json}"}`, `{"q": "${unknown:druid:json}"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interpolateTemplateVariables(tt.expr, timeRange); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInterpolateTemplateVariablesWithoutTimeRange(t *testing.T) {
+	expr := `{"from": "$__from", "to": "${__to:date:iso}"}`
+	if got := interpolateTemplateVariables(expr, backend.TimeRange{}); got != expr {
+		t.Errorf("expected %s, got %s", expr, got)
+	}
+}
+
+func TestInterpolateVariables(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2022, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+	values := map[string]string{
+		"__interval":      "1m",
+		"__interval_ms":   "60000",
+		"__range":         "3600s",
+		"__range_s":       "3600",
+		"__range_ms":      "3600000",
+		"__rate_interval": "1m0s",
+	}
+	type testCase struct {
+		name string
+		expr string
+		want string
+	}
+	var tests []testCase
+	for name, value := range values {
+		tests = append(tests,
+			testCase{name + ` "${}"`, `{"v": "${` + name + `}"}`, `{"v": "` + value + `"}`},
+			testCase{name + ` "$"`, `{"v": "$` + name + `"}`, `{"v": "` + value + `"}`},
+			testCase{name + ` $`, `{"v": "every $` + name + ` here"}`, `{"v": "every ` + value + ` here"}`},
+			testCase{name + ` ${}`, `{"v": "every ${` + name + `} here"}`, `{"v": "every ` + value + ` here"}`},
+			testCase{name + ` ${} suffixed`, `{"v": "${` + name + `}_x"}`, `{"v": "` + value + `_x"}`},
+		)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interpolateVariables(tt.expr, time.Minute, timeRange)
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(got), &v); err != nil {
+				t.Errorf("expected valid JSON, got %s: %v", got, err)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{500 * time.Millisecond, "500ms"},
+		{30 * time.Second, "30s"},
+		{5 * time.Minute, "5m"},
+		{2 * time.Hour, "2h"},
+		{3 * 24 * time.Hour, "3d"},
+		{400 * 24 * time.Hour, "1y"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.interval); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.interval, tt.want, got)
+		}
+	}
+}
@@ -33,7 +33,13 @@ export class ConfigEditor extends PureComponent<Props, State> {
     const { options, onOptionsChange } = this.props;
     const { settings, secretSettings, secretSettingsFields } = connectionSettingsOptions;
     const connectionSettings = normalizeData(settings, true, 'connection');
-    const jsonData = { ...options.jsonData, ...connectionSettings };
+    // Grafana only forwards OAuth identities and proxies datasources having these top level settings
+    const jsonData = {
+      ...options.jsonData,
+      ...connectionSettings,
+      oauthPassThru: settings.oauthPassThru,
+      enableSecureSocksProxy: settings.enableSecureSocksProxy,
+    };
     const connectionSecretSettings = normalizeData(secretSettings, true, 'connection');
     const secureJsonData = { ...options.secureJsonData, ...connectionSecretSettings };
     const connectionSecretSettingsFields = normalizeData(
@@ -24,7 +24,35 @@ export class DruidDataSource extends DataSourceWithBackend<DruidQuery, DruidSett
         return match;
       }
     );
-    return { ...JSON.parse(templateSrv.replace(template, scopedVars)), expr: templatedQuery.expr };
+    return {
+      ...JSON.parse(templateSrv.replace(template, scopedVars)),
+      expr: templatedQuery.expr,
+      // getAdhocFilters isn't part of the TemplateSrv interface yet
+      adhocFilters: (templateSrv as any).getAdhocFilters(this.name),
+    };
+  }
+  async getTagKeys(options?: any): Promise<MetricFindValue[]> {
+    return this.postResource('tag-keys', {});
+  }
+  async getTagValues(options: any): Promise<MetricFindValue[]> {
+    const range = options.timeRange;
+    return this.postResource('tag-values', {
+      key: options.key,
+      from: range ? range.from.valueOf() : undefined,
+      to: range ? range.to.valueOf() : undefined,
+    });
+  }
+  async getDatasources(): Promise<string[]> {
+    return this.getResource('datasources');
+  }
+  async getColumns(datasource: string): Promise<Array<{ name: string; type: string }>> {
+    return this.getResource('datasources/' + encodeURIComponent(datasource) + '/columns');
+  }
+  async getLookups(): Promise<string[]> {
+    return this.getResource('lookups');
+  }
+  async getTimeBoundary(datasource: string): Promise<{ minTime: string; maxTime: string }> {
+    return this.getResource('time-boundary/' + encodeURIComponent(datasource));
   }
   async metricFindQuery(query: DruidQuery, options?: any): Promise<MetricFindValue[]> {
     return this.postResource('query-variable', this.applyTemplateVariables(query)).then((response) => {
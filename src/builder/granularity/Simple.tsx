@@ -11,8 +11,9 @@ export const Simple = (props: QueryBuilderProps) => {
         onOptionsChange={onOptionsChange}
         name="Granularity"
         label="Granularity"
-        description="Specifies the granularity to use to bucket timestamps"
+        description="Specifies the granularity to use to bucket timestamps. Auto picks one from the time range and the maximum data points"
         entries={{
+          auto: 'Auto',
           all: 'All',
           none: 'None',
           second: 'Second',
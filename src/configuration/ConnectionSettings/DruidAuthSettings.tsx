@@ -2,7 +2,7 @@ import React, { ChangeEvent } from 'react';
 import { css } from '@emotion/css';
 import { FieldSet, Field, Switch } from '@grafana/ui';
 import { ConnectionSettingsProps } from './types';
-import { DruidBasicAuthSettings, DruidmTLSSettings } from './';
+import { DruidBasicAuthSettings, DruidBearerAuthSettings, DruidHttpHeadersSettings, DruidmTLSSettings, DruidTLSSettings } from './';
 
 export const DruidAuthSettings = (props: ConnectionSettingsProps) => {
   const { options, onOptionsChange } = props;
@@ -16,6 +16,10 @@ export const DruidAuthSettings = (props: ConnectionSettingsProps) => {
         settings.basicAuth = event!.currentTarget.checked;
         break;
       }
+      case 'bearerAuth': {
+        settings.bearerAuth = event!.currentTarget.checked;
+        break;
+      }
       case 'mTLS': {
         settings.mTLS = event!.currentTarget.checked;
         break;
@@ -35,6 +39,9 @@ export const DruidAuthSettings = (props: ConnectionSettingsProps) => {
         <Field horizontal label="With basic authentication" description="Enable HTTP Basic authentication">
           <Switch value={settings.basicAuth} name="basicAuth" onChange={onSettingChange} />
         </Field>
+        <Field horizontal label="With bearer token" description="Enable bearer token authentication">
+          <Switch value={settings.bearerAuth} name="bearerAuth" onChange={onSettingChange} />
+        </Field>
         {isHttps && (
             <Field horizontal label="With mTLS" description="Enable mutual TLS authentication">
               <Switch value={settings.mTLS} name="mTLS" onChange={onSettingChange} />
@@ -42,7 +49,10 @@ export const DruidAuthSettings = (props: ConnectionSettingsProps) => {
         )}
       </FieldSet>
       {settings.basicAuth && <DruidBasicAuthSettings {...props} />}
+      {settings.bearerAuth && <DruidBearerAuthSettings {...props} />}
+      {isHttps && <DruidTLSSettings {...props} />}
       {isHttps && settings.mTLS && <DruidmTLSSettings {...props} />}
+      <DruidHttpHeadersSettings {...props} />
     </>
   );
 };
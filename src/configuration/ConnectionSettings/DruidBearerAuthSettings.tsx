@@ -0,0 +1,50 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, FieldSet } from '@grafana/ui';
+import { ConnectionSettingsProps } from './types';
+
+const { SecretFormField } = LegacyForms;
+
+export const DruidBearerAuthSettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { secretSettings, secretSettingsFields } = options;
+  const onSecretSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const value = event.target.value;
+    switch (event.target.name) {
+      case 'token': {
+        secretSettings.bearerToken = value;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, secretSettings: secretSettings });
+  };
+  const onTokenReset = () => {
+    onOptionsChange({
+      ...options,
+      secretSettingsFields: {
+        ...secretSettingsFields,
+        bearerToken: false,
+      },
+      secretSettings: {
+        ...secretSettings,
+        bearerToken: '',
+      },
+    });
+  };
+  return (
+    <FieldSet label="Bearer Token Authentication">
+      <SecretFormField
+        label="Token"
+        name="token"
+        type="password"
+        placeholder="the token"
+        tooltip="Sent in the Authorization header as a bearer token. A forwarded OAuth identity takes precedence over it."
+        labelWidth={11}
+        inputWidth={20}
+        isConfigured={(secretSettingsFields && secretSettingsFields.bearerToken) as boolean}
+        value={secretSettings.bearerToken || ''}
+        onChange={onSecretSettingChange}
+        onReset={onTokenReset}
+      />
+    </FieldSet>
+  );
+};
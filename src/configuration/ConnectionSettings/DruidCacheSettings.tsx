@@ -0,0 +1,97 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, FieldSet, Field, Switch } from '@grafana/ui';
+import { ConnectionSettingsProps } from './types';
+
+const { FormField } = LegacyForms;
+
+export const DruidCacheSettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings } = options;
+  const onSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const value = event.target.value;
+    switch (event.target.name) {
+      case 'queryCacheTtl': {
+        settings.queryCacheTtl = +value;
+        break;
+      }
+      case 'queryCacheMaxSize': {
+        settings.queryCacheMaxSize = +value;
+        break;
+      }
+      case 'incrementalCache': {
+        settings.incrementalCache = event!.currentTarget.checked;
+        break;
+      }
+      case 'incrementalCacheTtl': {
+        settings.incrementalCacheTtl = +value;
+        break;
+      }
+      case 'incrementalCacheMaxSize': {
+        settings.incrementalCacheMaxSize = +value;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, settings: settings });
+  };
+  return (
+    <>
+      <FieldSet label="Query cache">
+        <FormField
+          label="Time to live (ms)"
+          name="queryCacheTtl"
+          type="number"
+          placeholder="0 (disabled)"
+          tooltip="How long identical queries are answered from the cache. The cache is disabled when not set."
+          labelWidth={11}
+          inputWidth={20}
+          value={settings.queryCacheTtl}
+          onChange={onSettingChange}
+        />
+        <FormField
+          label="Maximum size (MB)"
+          name="queryCacheMaxSize"
+          type="number"
+          placeholder="10"
+          labelWidth={11}
+          inputWidth={20}
+          value={settings.queryCacheMaxSize}
+          onChange={onSettingChange}
+        />
+      </FieldSet>
+      <FieldSet label="Incremental cache">
+        <Field
+          horizontal
+          label="Enabled"
+          description="Cache the complete time buckets of timeseries queries, to only query Druid for the recent ones when refreshing"
+        >
+          <Switch value={settings.incrementalCache} name="incrementalCache" onChange={onSettingChange} />
+        </Field>
+        {settings.incrementalCache && (
+          <>
+            <FormField
+              label="Time to live (ms)"
+              name="incrementalCacheTtl"
+              type="number"
+              placeholder="3600000"
+              tooltip="How long complete time buckets are answered from the cache"
+              labelWidth={11}
+              inputWidth={20}
+              value={settings.incrementalCacheTtl}
+              onChange={onSettingChange}
+            />
+            <FormField
+              label="Maximum size (MB)"
+              name="incrementalCacheMaxSize"
+              type="number"
+              placeholder="10"
+              labelWidth={11}
+              inputWidth={20}
+              value={settings.incrementalCacheMaxSize}
+              onChange={onSettingChange}
+            />
+          </>
+        )}
+      </FieldSet>
+    </>
+  );
+};
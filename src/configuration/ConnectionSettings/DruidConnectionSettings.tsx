@@ -1,12 +1,16 @@
 import React from 'react';
-import { DruidHttpSettings, DruidAuthSettings } from './';
+import { DruidHttpSettings, DruidEndpointsSettings, DruidProxySettings, DruidAuthSettings, DruidIdentitySettings, DruidCacheSettings } from './';
 import { ConnectionSettingsProps } from './types';
 
 export const DruidConnectionSettings = (props: ConnectionSettingsProps) => {
   return (
     <>
       <DruidHttpSettings {...props} />
+      <DruidEndpointsSettings {...props} />
+      <DruidProxySettings {...props} />
       <DruidAuthSettings {...props} />
+      <DruidIdentitySettings {...props} />
+      <DruidCacheSettings {...props} />
     </>
   );
 };
@@ -0,0 +1,87 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, FieldSet, Field, Select } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { ConnectionSettingsProps } from './types';
+
+const { FormField } = LegacyForms;
+
+const loadBalancingSelectOptions: Array<SelectableValue<string>> = [
+  { label: 'Priority', value: 'priority', description: 'Query the first healthy URL, in order' },
+  { label: 'Round robin', value: 'roundRobin', description: 'Query the healthy URLs in turn' },
+];
+
+export const DruidEndpointsSettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings } = options;
+  const onSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const value = event.target.value;
+    switch (event.target.name) {
+      case 'additionalUrls': {
+        settings.additionalUrls = value.split(',').map((url) => url.trim());
+        break;
+      }
+      case 'healthCheckInterval': {
+        settings.healthCheckInterval = +value;
+        break;
+      }
+      case 'responseTimeout': {
+        settings.responseTimeout = +value;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, settings: settings });
+  };
+  const onLoadBalancingSelectionChange = (option: SelectableValue<string>) => {
+    onOptionsChange({ ...options, settings: { ...settings, loadBalancing: option.value } });
+  };
+  const additionalUrls = (settings.additionalUrls || []).filter((url) => url !== '');
+  return (
+    <FieldSet label="Failover">
+      <FormField
+        label="Additional URLs"
+        name="additionalUrls"
+        type="text"
+        placeholder="e.g: http://router-2:8888, http://router-3:8888"
+        tooltip="Other brokers or routers of the cluster, comma separated. Queries go to the healthy ones, failing over to the next one when a broker or router doesn't answer."
+        labelWidth={11}
+        inputWidth={20}
+        value={(settings.additionalUrls || []).join(', ')}
+        onChange={onSettingChange}
+      />
+      {additionalUrls.length > 0 && (
+        <>
+          <Field horizontal label="Load balancing" description="How the URLs to query are picked">
+            <Select
+              options={loadBalancingSelectOptions}
+              value={loadBalancingSelectOptions.find((option) => option.value === (settings.loadBalancing || 'priority'))}
+              onChange={onLoadBalancingSelectionChange}
+              width={20}
+            />
+          </Field>
+          <FormField
+            label="Health check interval (ms)"
+            name="healthCheckInterval"
+            type="number"
+            placeholder="30000"
+            tooltip="Interval between two checks of the status of the unhealthy URLs, to query them again once back"
+            labelWidth={11}
+            inputWidth={20}
+            value={settings.healthCheckInterval}
+            onChange={onSettingChange}
+          />
+          <FormField
+            label="Response timeout (ms)"
+            name="responseTimeout"
+            type="number"
+            placeholder="none"
+            tooltip="Maximum time given to a broker or router to start answering a query, none when empty. Queries not answered in time fail without failing over, as they would be as slow on the other URLs."
+            labelWidth={11}
+            inputWidth={20}
+            value={settings.responseTimeout}
+            onChange={onSettingChange}
+          />
+        </>
+      )}
+    </FieldSet>
+  );
+};
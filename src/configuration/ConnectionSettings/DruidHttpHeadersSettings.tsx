@@ -0,0 +1,103 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, FieldSet, Button, Icon } from '@grafana/ui';
+import { ConnectionSettingsProps } from './types';
+
+const { FormField, SecretFormField } = LegacyForms;
+
+const headerNamePrefix = 'httpHeaderName';
+const headerValuePrefix = 'httpHeaderValue';
+
+export const DruidHttpHeadersSettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings, secretSettings, secretSettingsFields } = options;
+  // headers are numbered, names being settings and values secret settings. Removed ones have a null name.
+  const headerSettings = settings as Record<string, any>;
+  const headerSecretSettings = secretSettings as Record<string, any>;
+  const indexes = Object.keys(headerSettings)
+    .filter((key) => key.startsWith(headerNamePrefix) && headerSettings[key] !== null)
+    .map((key) => parseInt(key.substring(headerNamePrefix.length), 10))
+    .filter((index) => !isNaN(index))
+    .sort((a, b) => a - b);
+  const onNameChange = (index: number, event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, [headerNamePrefix + index]: event.target.value } });
+  };
+  const onValueChange = (index: number, event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      secretSettings: { ...secretSettings, [headerValuePrefix + index]: event.target.value },
+    });
+  };
+  const onValueReset = (index: number) => {
+    onOptionsChange({
+      ...options,
+      secretSettingsFields: { ...secretSettingsFields, [headerValuePrefix + index]: false },
+      secretSettings: { ...secretSettings, [headerValuePrefix + index]: '' },
+    });
+  };
+  const onAdd = () => {
+    const allIndexes = Object.keys(headerSettings)
+      .filter((key) => key.startsWith(headerNamePrefix))
+      .map((key) => parseInt(key.substring(headerNamePrefix.length), 10))
+      .filter((index) => !isNaN(index));
+    const index = allIndexes.length > 0 ? Math.max(...allIndexes) + 1 : 1;
+    onOptionsChange({ ...options, settings: { ...settings, [headerNamePrefix + index]: '' } });
+  };
+  const onRemove = (index: number) => {
+    onOptionsChange({
+      ...options,
+      settings: { ...settings, [headerNamePrefix + index]: null },
+      secretSettingsFields: { ...secretSettingsFields, [headerValuePrefix + index]: false },
+      secretSettings: { ...secretSettings, [headerValuePrefix + index]: '' },
+    });
+  };
+  return (
+    <FieldSet label="Custom HTTP Headers">
+      {indexes.map((index) => (
+        <div className="gf-form-inline" key={index}>
+          <FormField
+            label="Header"
+            name="name"
+            type="text"
+            placeholder="the header name. e.g: X-Tenant"
+            labelWidth={11}
+            inputWidth={12}
+            value={headerSettings[headerNamePrefix + index] || ''}
+            onChange={(event: ChangeEvent<HTMLInputElement>) => onNameChange(index, event)}
+          />
+          <SecretFormField
+            label="Value"
+            name="value"
+            type="password"
+            placeholder="the header value"
+            labelWidth={5}
+            inputWidth={12}
+            isConfigured={(secretSettingsFields && secretSettingsFields[headerValuePrefix + index]) as boolean}
+            value={headerSecretSettings[headerValuePrefix + index] || ''}
+            onChange={(event: ChangeEvent<HTMLInputElement>) => onValueChange(index, event)}
+            onReset={() => onValueReset(index)}
+          />
+          <Button
+            variant="secondary"
+            size="sm"
+            onClick={(event) => {
+              onRemove(index);
+              event.preventDefault();
+            }}
+          >
+            <Icon name="trash-alt" />
+          </Button>
+        </div>
+      ))}
+      <Button
+        variant="secondary"
+        icon="plus"
+        onClick={(event) => {
+          onAdd();
+          event.preventDefault();
+        }}
+      >
+        Add header
+      </Button>
+    </FieldSet>
+  );
+};
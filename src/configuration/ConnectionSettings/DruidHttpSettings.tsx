@@ -27,6 +27,10 @@ export const DruidHttpSettings = (props: ConnectionSettingsProps) => {
         settings.retryableRetryWaitMax = +value;
         break;
       }
+      case 'maxConcurrentQueries': {
+        settings.maxConcurrentQueries = +value;
+        break;
+      }
       case 'skipTls': {
         settings.skipTls = event!.currentTarget.checked;
         break;
@@ -82,6 +86,16 @@ export const DruidHttpSettings = (props: ConnectionSettingsProps) => {
         value={settings.retryableRetryWaitMax}
         onChange={onSettingChange}
       />
+      <FormField
+        label="Maximum concurrent queries"
+        name="maxConcurrentQueries"
+        type="number"
+        placeholder="10"
+        labelWidth={11}
+        inputWidth={20}
+        value={settings.maxConcurrentQueries}
+        onChange={onSettingChange}
+      />
       {isHttps && (
         <Field
           horizontal
@@ -0,0 +1,64 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, FieldSet, Field, Switch, Select } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { ConnectionSettingsProps } from './types';
+
+const { FormField } = LegacyForms;
+
+const oauthTokenSelectOptions: Array<SelectableValue<string>> = [
+  { label: 'Access token', value: 'access', description: 'Forward the OAuth access token' },
+  { label: 'ID token', value: 'id', description: 'Forward the OAuth ID token as a bearer token' },
+];
+
+export const DruidIdentitySettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings } = options;
+  const onSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    switch (event.target.name) {
+      case 'oauthPassThru': {
+        settings.oauthPassThru = event!.currentTarget.checked;
+        break;
+      }
+      case 'userHeader': {
+        settings.userHeader = event.target.value;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, settings: settings });
+  };
+  const onOAuthTokenSelectionChange = (option: SelectableValue<string>) => {
+    onOptionsChange({ ...options, settings: { ...settings, oauthToken: option.value } });
+  };
+  return (
+    <FieldSet label="Identity forwarding">
+      <Field
+        horizontal
+        label="Forward OAuth identity"
+        description="Query Druid with the OAuth token of the Grafana user, as a bearer token"
+      >
+        <Switch value={settings.oauthPassThru} name="oauthPassThru" onChange={onSettingChange} />
+      </Field>
+      {settings.oauthPassThru && (
+        <Field horizontal label="Token" description="The OAuth token to forward">
+          <Select
+            options={oauthTokenSelectOptions}
+            value={oauthTokenSelectOptions.find((option) => option.value === (settings.oauthToken || 'access'))}
+            onChange={onOAuthTokenSelectionChange}
+            width={20}
+          />
+        </Field>
+      )}
+      <FormField
+        label="User header"
+        name="userHeader"
+        type="text"
+        placeholder="e.g: X-Grafana-User"
+        tooltip="Header sending the login of the Grafana user, for Druid to trust it behind an authenticating proxy. Not sent when empty."
+        labelWidth={11}
+        inputWidth={20}
+        value={settings.userHeader}
+        onChange={onSettingChange}
+      />
+    </FieldSet>
+  );
+};
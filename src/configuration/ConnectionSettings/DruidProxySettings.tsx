@@ -0,0 +1,118 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, FieldSet, Field, Switch } from '@grafana/ui';
+import { ConnectionSettingsProps } from './types';
+
+const { FormField, SecretFormField } = LegacyForms;
+
+export const DruidProxySettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings, secretSettings, secretSettingsFields } = options;
+  const onSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const value = event.target.value;
+    switch (event.target.name) {
+      case 'proxyUrl': {
+        settings.proxyUrl = value;
+        break;
+      }
+      case 'proxyUser': {
+        settings.proxyUser = value;
+        break;
+      }
+      case 'noProxy': {
+        settings.noProxy = value;
+        break;
+      }
+      case 'enableSecureSocksProxy': {
+        settings.enableSecureSocksProxy = event!.currentTarget.checked;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, settings: settings });
+  };
+  const onSecretSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const value = event.target.value;
+    switch (event.target.name) {
+      case 'proxyPassword': {
+        secretSettings.proxyPassword = value;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, secretSettings: secretSettings });
+  };
+  const onPasswordReset = () => {
+    onOptionsChange({
+      ...options,
+      secretSettingsFields: {
+        ...secretSettingsFields,
+        proxyPassword: false,
+      },
+      secretSettings: {
+        ...secretSettings,
+        proxyPassword: '',
+      },
+    });
+  };
+  return (
+    <FieldSet label="Proxy">
+      <Field
+        horizontal
+        label="Secure Socks Proxy"
+        description="Connect through the Grafana secure socks proxy, when enabled in Grafana"
+      >
+        <Switch value={settings.enableSecureSocksProxy} name="enableSecureSocksProxy" onChange={onSettingChange} />
+      </Field>
+      {!settings.enableSecureSocksProxy && (
+        <>
+          <FormField
+            label="Proxy URL"
+            name="proxyUrl"
+            type="url"
+            placeholder="e.g: http://proxy:3128 or socks5://proxy:1080"
+            tooltip="Proxy the requests to Druid go through. When empty, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply."
+            labelWidth={11}
+            inputWidth={20}
+            value={settings.proxyUrl}
+            onChange={onSettingChange}
+          />
+          {settings.proxyUrl && (
+            <>
+              <FormField
+                label="Proxy user"
+                name="proxyUser"
+                type="text"
+                placeholder="the proxy user, if any"
+                labelWidth={11}
+                inputWidth={20}
+                value={settings.proxyUser}
+                onChange={onSettingChange}
+              />
+              <SecretFormField
+                label="Proxy password"
+                name="proxyPassword"
+                type="password"
+                placeholder="the proxy password"
+                labelWidth={11}
+                inputWidth={20}
+                isConfigured={(secretSettingsFields && secretSettingsFields.proxyPassword) as boolean}
+                value={secretSettings.proxyPassword || ''}
+                onChange={onSecretSettingChange}
+                onReset={onPasswordReset}
+              />
+              <FormField
+                label="No proxy"
+                name="noProxy"
+                type="text"
+                placeholder="e.g: .internal, 10.0.0.0/8"
+                tooltip="Hosts reached without the proxy, comma separated, as for the NO_PROXY environment variable"
+                labelWidth={11}
+                inputWidth={20}
+                value={settings.noProxy}
+                onChange={onSettingChange}
+              />
+            </>
+          )}
+        </>
+      )}
+    </FieldSet>
+  );
+};
@@ -0,0 +1,138 @@
+import React, { ChangeEvent } from 'react';
+import { LegacyForms, SecretTextArea, FieldSet, Field, Switch, Select, MultiSelect } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { ConnectionSettingsProps } from './types';
+
+const { FormField } = LegacyForms;
+
+const tlsMinVersionSelectOptions: Array<SelectableValue<string>> = [
+  { label: 'TLS 1.0', value: '1.0' },
+  { label: 'TLS 1.1', value: '1.1' },
+  { label: 'TLS 1.2', value: '1.2' },
+  { label: 'TLS 1.3', value: '1.3' },
+];
+
+const tlsCipherSuiteSelectOptions: Array<SelectableValue<string>> = [
+  'TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256',
+  'TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384',
+  'TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256',
+  'TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256',
+  'TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384',
+  'TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256',
+  'TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA',
+  'TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA',
+  'TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA',
+  'TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA',
+  'TLS_RSA_WITH_AES_128_GCM_SHA256',
+  'TLS_RSA_WITH_AES_256_GCM_SHA384',
+  'TLS_RSA_WITH_AES_128_CBC_SHA',
+  'TLS_RSA_WITH_AES_256_CBC_SHA',
+].map((suite) => ({ label: suite, value: suite }));
+
+export const DruidTLSSettings = (props: ConnectionSettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings, secretSettings, secretSettingsFields } = options;
+  const onSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    switch (event.target.name) {
+      case 'tlsServerName': {
+        settings.tlsServerName = event.target.value;
+        break;
+      }
+      case 'tlsCustomCa': {
+        settings.tlsCustomCa = event!.currentTarget.checked;
+        break;
+      }
+      case 'use_system_ca_pool': {
+        settings.mTLSUseSystemCaPool = event!.currentTarget.checked;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, settings: settings });
+  };
+  const onSecretSettingChange = (event: ChangeEvent<HTMLTextAreaElement>) => {
+    switch (event.target.name) {
+      case 'ca': {
+        secretSettings.mTLSCa = event.target.value;
+        break;
+      }
+    }
+    onOptionsChange({ ...options, secretSettings: secretSettings });
+  };
+  const onCaReset = () => {
+    onOptionsChange({
+      ...options,
+      secretSettingsFields: {
+        ...secretSettingsFields,
+        mTLSCa: false,
+      },
+      secretSettings: {
+        ...secretSettings,
+        mTLSCa: '',
+      },
+    });
+  };
+  const onMinVersionSelectionChange = (option: SelectableValue<string> | null) => {
+    onOptionsChange({ ...options, settings: { ...settings, tlsMinVersion: option ? option.value : undefined } });
+  };
+  const onCipherSuitesSelectionChange = (selection: Array<SelectableValue<string>>) => {
+    onOptionsChange({
+      ...options,
+      settings: { ...settings, tlsCipherSuites: selection.map((option) => option.value!) },
+    });
+  };
+  return (
+    <FieldSet label="TLS Settings">
+      {!settings.mTLS && (
+        <Field horizontal label="Custom CA" description="Verify the server certificate against a custom CA">
+          <Switch value={settings.tlsCustomCa} name="tlsCustomCa" onChange={onSettingChange} />
+        </Field>
+      )}
+      {(settings.tlsCustomCa || settings.mTLS) && (
+        <>
+          <Field label="CA Certificate" description="Verify the server certificate against this CA, with or without mTLS">
+            <SecretTextArea
+              name="ca"
+              type="password"
+              placeholder="the CA certificate"
+              cols={100}
+              isConfigured={(secretSettingsFields && secretSettingsFields.mTLSCa) as boolean}
+              // @ts-ignore
+              onChange={onSecretSettingChange}
+              onReset={onCaReset}
+            />
+          </Field>
+          <Field label="Use System CA Pool" description="Also trust the system CA pool when a CA certificate is set">
+            <Switch value={settings.mTLSUseSystemCaPool} name="use_system_ca_pool" onChange={onSettingChange} />
+          </Field>
+        </>
+      )}
+      <FormField
+        label="Server name"
+        name="tlsServerName"
+        type="text"
+        placeholder="e.g: druid.example.com"
+        tooltip="Name the server certificate is verified against, when it differs from the URL host"
+        labelWidth={11}
+        inputWidth={20}
+        value={settings.tlsServerName}
+        onChange={onSettingChange}
+      />
+      <Field horizontal label="Minimum TLS version">
+        <Select
+          options={tlsMinVersionSelectOptions}
+          value={tlsMinVersionSelectOptions.find((option) => option.value === settings.tlsMinVersion)}
+          onChange={onMinVersionSelectionChange}
+          isClearable
+          width={20}
+        />
+      </Field>
+      <Field label="Cipher suites" description="Cipher suites allowed up to TLS 1.2, all the secure ones when none">
+        <MultiSelect
+          options={tlsCipherSuiteSelectOptions}
+          value={settings.tlsCipherSuites}
+          onChange={onCipherSuitesSelectionChange}
+        />
+      </Field>
+    </FieldSet>
+  );
+};
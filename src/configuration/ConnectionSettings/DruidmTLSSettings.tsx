@@ -1,10 +1,10 @@
 import React, { ChangeEvent } from 'react';
-import {SecretTextArea, FieldSet, Field, Switch} from '@grafana/ui';
+import { SecretTextArea, FieldSet, Field } from '@grafana/ui';
 import { ConnectionSettingsProps } from './types';
 
 export const DruidmTLSSettings = (props: ConnectionSettingsProps) => {
   const { options, onOptionsChange } = props;
-  const { settings, secretSettings, secretSettingsFields } = options;
+  const { secretSettings, secretSettingsFields } = options;
   const onSettingChange = (event: ChangeEvent<HTMLInputElement>) => {
     const value = event.target.value;
     switch (event.target.name) {
@@ -16,14 +16,6 @@ export const DruidmTLSSettings = (props: ConnectionSettingsProps) => {
         secretSettings.mTLSKey = value;
         break;
       }
-      case 'ca': {
-        secretSettings.mTLSCa = value;
-        break;
-      }
-      case 'use_system_ca_pool': {
-        settings.mTLSUseSystemCaPool = event!.currentTarget.checked;
-        break;
-      }
     }
     onOptionsChange({ ...options, secretSettings: secretSettings });
   };
@@ -53,19 +45,6 @@ export const DruidmTLSSettings = (props: ConnectionSettingsProps) => {
       },
     });
   };
-  const onCaReset = () => {
-    onOptionsChange({
-      ...options,
-      secretSettingsFields: {
-        ...secretSettingsFields,
-        mTLSCa: false,
-      },
-      secretSettings: {
-        ...secretSettings,
-        mTLSCa: '',
-      },
-    });
-  };
   return (
         <FieldSet label="mTLS Settings">
           <Field
@@ -96,26 +75,6 @@ export const DruidmTLSSettings = (props: ConnectionSettingsProps) => {
               onReset={onKeyReset}
             />
           </Field>
-          <Field
-            label="CA Certificate"
-          >
-            <SecretTextArea
-              name="ca"
-              type="password"
-              placeholder="the CA certificate"
-              cols={100}
-              isConfigured={(secretSettingsFields && secretSettingsFields.mTLSCa) as boolean}
-              // @ts-ignore
-              onChange={onSettingChange}
-              onReset={onCaReset}
-            />
-          </Field>
-            <Field
-                label="Use System CA Pool"
-                description="Use the system CA pool for TLS verification"
-            >
-              <Switch value={settings.mTLSUseSystemCaPool} name="use_system_ca_pool" onChange={onSettingChange} />
-            </Field>
         </FieldSet>
   );
 };
@@ -1,5 +1,12 @@
 export { DruidConnectionSettings } from './DruidConnectionSettings';
 export { DruidHttpSettings } from './DruidHttpSettings';
+export { DruidEndpointsSettings } from './DruidEndpointsSettings';
+export { DruidProxySettings } from './DruidProxySettings';
 export { DruidAuthSettings } from './DruidAuthSettings';
+export { DruidCacheSettings } from './DruidCacheSettings';
+export { DruidIdentitySettings } from './DruidIdentitySettings';
 export { DruidBasicAuthSettings } from './DruidBasicAuthSettings';
+export { DruidBearerAuthSettings } from './DruidBearerAuthSettings';
+export { DruidHttpHeadersSettings } from './DruidHttpHeadersSettings';
 export { DruidmTLSSettings } from './DruidmTLSSettings';
+export { DruidTLSSettings } from './DruidTLSSettings';
@@ -2,17 +2,41 @@ import { KeyValue } from '@grafana/data';
 
 export interface ConnectionSettings {
   url?: string;
+  additionalUrls?: string[];
+  loadBalancing?: string;
+  healthCheckInterval?: number;
+  responseTimeout?: number;
   retryableRetryMax?: number;
   retryableRetryWaitMin?: number;
   retryableRetryWaitMax?: number;
+  maxConcurrentQueries?: number;
+  queryCacheTtl?: number;
+  queryCacheMaxSize?: number;
+  incrementalCache?: boolean;
+  incrementalCacheTtl?: number;
+  incrementalCacheMaxSize?: number;
   basicAuth?: boolean;
   basicAuthUser?: string;
+  bearerAuth?: boolean;
   skipTls?: boolean;
   mTLS?: boolean;
   mTLSUseSystemCaPool?: boolean;
+  tlsCustomCa?: boolean;
+  tlsServerName?: string;
+  tlsMinVersion?: string;
+  tlsCipherSuites?: string[];
+  oauthPassThru?: boolean;
+  oauthToken?: string;
+  userHeader?: string;
+  proxyUrl?: string;
+  proxyUser?: string;
+  noProxy?: string;
+  enableSecureSocksProxy?: boolean;
 }
 export interface ConnectionSecretSettings {
   basicAuthPassword?: string;
+  bearerToken?: string;
+  proxyPassword?: string;
   mTLSCert?: string;
   mTLSKey?: string;
   mTLSCa?: string;
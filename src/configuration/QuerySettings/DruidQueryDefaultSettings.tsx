@@ -1,10 +1,15 @@
-import React from 'react';
-import { FieldSet } from '@grafana/ui';
+import React, { ChangeEvent } from 'react';
+import { FieldSet, InlineFieldRow, InlineField, Input } from '@grafana/ui';
 import { css, cx } from '@emotion/css';
 import { DruidQueryRequestSettings, DruidQueryResponseSettings } from './';
 import { QuerySettingsProps } from './types';
 
 export const DruidQueryDefaultSettings = (props: QuerySettingsProps) => {
+  const { options, onOptionsChange } = props;
+  const { settings } = options;
+  const onAdhocFiltersDatasourceChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, adhocFiltersDatasource: event.target.value } });
+  };
   return (
     <>
       <FieldSet label="Request" className={cx(styles.fieldset)}>
@@ -13,6 +18,17 @@ export const DruidQueryDefaultSettings = (props: QuerySettingsProps) => {
       <FieldSet label="Response" className={cx(styles.fieldset)}>
         <DruidQueryResponseSettings {...props} />
       </FieldSet>
+      <FieldSet label="Ad hoc filters" className={cx(styles.fieldset)}>
+        <InlineFieldRow>
+          <InlineField label="Datasource" tooltip="The Druid datasource whose columns and values ad hoc filters propose">
+            <Input
+              placeholder="Druid datasource name. e.g: wikipedia"
+              value={settings.adhocFiltersDatasource}
+              onChange={onAdhocFiltersDatasourceChange}
+            />
+          </InlineField>
+        </InlineFieldRow>
+      </FieldSet>
     </>
   );
 };
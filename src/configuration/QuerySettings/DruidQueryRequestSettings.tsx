@@ -1,5 +1,5 @@
 import React, { ChangeEvent } from 'react';
-import { InlineFieldRow, InlineField, Input } from '@grafana/ui';
+import { InlineFieldRow, InlineField, InlineSwitch, Input } from '@grafana/ui';
 import { QuerySettingsProps } from './types';
 import { DruidQueryContextSettings } from './DruidQueryContextSettings';
 
@@ -9,6 +9,15 @@ export const DruidQueryRequestSettings = (props: QuerySettingsProps) => {
   const onDebounceTimeChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, settings: { ...settings, debounceTime: Number(event.target.value) } });
   };
+  const onDisableCacheChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, disableCache: event!.currentTarget.checked } });
+  };
+  const onMinIntervalChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, minInterval: Number(event.target.value) } });
+  };
+  const onUseDashboardTimeRangeChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, useDashboardTimeRange: event!.currentTarget.checked } });
+  };
   return (
     <>
       <InlineFieldRow>
@@ -24,6 +33,29 @@ export const DruidQueryRequestSettings = (props: QuerySettingsProps) => {
           />
         </InlineField>
       </InlineFieldRow>
+      <InlineFieldRow>
+        <InlineField label="Disable cache" tooltip="Always query Druid, even when the datasource query cache is enabled">
+          <InlineSwitch value={settings.disableCache} onChange={onDisableCacheChange} />
+        </InlineField>
+      </InlineFieldRow>
+      <InlineFieldRow>
+        <InlineField
+          label="Use dashboard time range"
+          tooltip="Query over the dashboard time range, even when the query defines its own intervals. Queries without intervals always use it."
+        >
+          <InlineSwitch value={settings.useDashboardTimeRange} onChange={onUseDashboardTimeRangeChange} />
+        </InlineField>
+      </InlineFieldRow>
+      <InlineFieldRow>
+        <InlineField label="Min interval" tooltip="Minimum bucket size, in milliseconds, of the auto granularity">
+          <Input
+            type="number"
+            placeholder="Minimum interval in milliseconds. e.g: 60000"
+            value={settings.minInterval}
+            onChange={onMinIntervalChange}
+          />
+        </InlineField>
+      </InlineFieldRow>
     </>
   );
 };
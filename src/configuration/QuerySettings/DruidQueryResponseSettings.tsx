@@ -19,12 +19,41 @@ export const DruidQueryResponseSettings = (props: QuerySettingsProps) => {
     const options = formatSelectOptions.filter((option) => option.value === value);
     return options.length > 0 ? options[0] : undefined;
   };
+  const arrayHandlingSelectOptions: Array<SelectableValue<string>> = [
+    { label: 'JSON', value: 'json', description: 'Render arrays as JSON strings' },
+    { label: 'Join', value: 'join', description: 'Render arrays as their elements joined by a separator' },
+    { label: 'Explode', value: 'explode', description: 'Return one row per array element' },
+  ];
+  const selectArrayHandlingOptionByValue = (value?: string): SelectableValue<string> | undefined => {
+    if (undefined === value) {
+      return undefined;
+    }
+    const options = arrayHandlingSelectOptions.filter((option) => option.value === value);
+    return options.length > 0 ? options[0] : undefined;
+  };
+  const onArrayHandlingSelectionChange = (option: SelectableValue<string>) => {
+    onOptionsChange({ ...options, settings: { ...settings, arrayHandling: option.value } });
+  };
+  const onArraySeparatorChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, arraySeparator: event.target.value } });
+  };
   const onFormatSelectionChange = (option: SelectableValue<string>) => {
     onOptionsChange({ ...options, settings: { ...settings, format: option.value } });
   };
   const onHideEmptyColumnsChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, settings: { ...settings, hideEmptyColumns: event!.currentTarget.checked } });
   };
+  const onLegacyNullHandlingChange = (event: ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({ ...options, settings: { ...settings, legacyNullHandling: event!.currentTarget.checked } });
+  };
+  const scanTimeOrderSelectOptions: Array<SelectableValue<string>> = [
+    { label: 'None', value: '' },
+    { label: 'Ascending', value: 'ascending' },
+    { label: 'Descending', value: 'descending' },
+  ];
+  const onScanTimeOrderSelectionChange = (option: SelectableValue<string>) => {
+    onOptionsChange({ ...options, settings: { ...settings, scanTimeOrder: option.value } });
+  };
   const onResponseLimitChange = (event: ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({ ...options, settings: { ...settings, responseLimit: Number(event.target.value) } });
   };
@@ -39,6 +68,23 @@ export const DruidQueryResponseSettings = (props: QuerySettingsProps) => {
           />
         </InlineField>
       </InlineFieldRow>
+      <InlineFieldRow>
+        <InlineField
+          label="Arrays"
+          tooltip="Changes how multi-value dimensions and array columns are returned"
+        >
+          <Select
+            onChange={onArrayHandlingSelectionChange}
+            options={arrayHandlingSelectOptions}
+            value={selectArrayHandlingOptionByValue(settings.arrayHandling)}
+          />
+        </InlineField>
+        {settings.arrayHandling === 'join' && (
+          <InlineField label="Separator" tooltip="String used to join the array elements">
+            <Input placeholder=", " value={settings.arraySeparator} onChange={onArraySeparatorChange} />
+          </InlineField>
+        )}
+      </InlineFieldRow>
       <InlineFieldRow>
         <InlineField label="Response Limit" tooltip="Limit the response rows to prevent browser overload">
           <Input
@@ -49,6 +95,15 @@ export const DruidQueryResponseSettings = (props: QuerySettingsProps) => {
           />
         </InlineField>
       </InlineFieldRow>
+      <InlineFieldRow>
+        <InlineField label="Scan time order" tooltip="Order scan query rows by __time">
+          <Select
+            onChange={onScanTimeOrderSelectionChange}
+            options={scanTimeOrderSelectOptions}
+            value={scanTimeOrderSelectOptions.find((option) => option.value === (settings.scanTimeOrder || ''))}
+          />
+        </InlineField>
+      </InlineFieldRow>
       <InlineFieldRow>
         <InlineField
           label="Hide empty columns"
@@ -57,6 +112,14 @@ export const DruidQueryResponseSettings = (props: QuerySettingsProps) => {
           <InlineSwitch value={settings.hideEmptyColumns} onChange={onHideEmptyColumnsChange} />
         </InlineField>
       </InlineFieldRow>
+      <InlineFieldRow>
+        <InlineField
+          label="Legacy null handling"
+          tooltip="Replace null values by zero values (0, empty string, false...) instead of returning nulls"
+        >
+          <InlineSwitch value={settings.legacyNullHandling} onChange={onLegacyNullHandlingChange} />
+        </InlineField>
+      </InlineFieldRow>
       {settings.format === 'log' && (
         <InlineFieldRow>
           <DruidQueryLogSettings {...props} />
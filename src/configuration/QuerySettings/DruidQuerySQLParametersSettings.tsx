@@ -0,0 +1,107 @@
+import React, { ChangeEvent } from 'react';
+import { InlineLabel, InlineField, InlineFieldRow, Input, Select, Button, Icon, useTheme, stylesFactory } from '@grafana/ui';
+import { GrafanaTheme, SelectableValue } from '@grafana/data';
+import { css, cx } from '@emotion/css';
+import { QuerySettingsProps, QuerySQLParameter } from './types';
+
+const typeSelectOptions: Array<SelectableValue<string>> = [
+  { label: 'VARCHAR', value: 'VARCHAR' },
+  { label: 'BIGINT', value: 'BIGINT' },
+  { label: 'DOUBLE', value: 'DOUBLE' },
+  { label: 'BOOLEAN', value: 'BOOLEAN' },
+  { label: 'TIMESTAMP', value: 'TIMESTAMP' },
+  { label: 'ARRAY', value: 'ARRAY' },
+];
+
+export const DruidQuerySQLParametersSettings = (props: QuerySettingsProps) => {
+  const theme = useTheme();
+  const styles = getStyles(theme);
+  const { options, onOptionsChange } = props;
+  const { settings } = options;
+  const parameters = settings.parameters !== undefined ? settings.parameters : [];
+  const setParameters = (parameters: QuerySQLParameter[]) => {
+    onOptionsChange({ ...options, settings: { ...settings, parameters: parameters } });
+  };
+  return (
+    <InlineFieldRow className={cx(styles.row)}>
+      <InlineLabel
+        width="auto"
+        tooltip="Values of the ? placeholders of SQL queries, in order. Use ${variable:druid:json} for multi-value variables."
+      >
+        SQL parameters
+      </InlineLabel>
+      {parameters.map((parameter: QuerySQLParameter, index: number) => (
+        <InlineFieldRow key={index} className={cx(styles.row)}>
+          <ParameterRow
+            parameter={parameter}
+            onChange={(p) => {
+              setParameters(parameters.map((current, i) => (i === index ? p : current)));
+            }}
+          />
+          <Button
+            variant="secondary"
+            size="xs"
+            onClick={(event) => {
+              setParameters(parameters.filter((_: QuerySQLParameter, i: number) => i !== index));
+              event.preventDefault();
+            }}
+          >
+            <Icon name="trash-alt" />
+          </Button>
+        </InlineFieldRow>
+      ))}
+      <Button
+        variant="secondary"
+        icon="plus"
+        onClick={(event) => {
+          setParameters([...parameters, { type: 'VARCHAR', value: [''] }]);
+          event.preventDefault();
+        }}
+      >
+        Add
+      </Button>
+    </InlineFieldRow>
+  );
+};
+
+const getStyles = stylesFactory((theme: GrafanaTheme) => {
+  return {
+    row: css`
+      width: 100%;
+      & > & {
+        border-left: 1px solid ${theme.colors.border2};
+        padding: 5px 0px 0px 10px;
+      }
+    `,
+  };
+});
+
+interface ParameterRowProps {
+  parameter: QuerySQLParameter;
+  onChange: (value: QuerySQLParameter) => void;
+}
+
+const ParameterRow = ({ parameter, onChange }: ParameterRowProps) => {
+  // the value is kept in an array so that multi-value variables formatted as JSON remain valid JSON
+  const value = Array.isArray(parameter.value) ? parameter.value[0] : parameter.value;
+  return (
+    <InlineFieldRow>
+      <InlineField label="Type">
+        <Select
+          options={typeSelectOptions}
+          value={typeSelectOptions.find((option) => option.value === parameter.type)}
+          onChange={(option: SelectableValue<string>) => onChange({ ...parameter, type: option.value || 'VARCHAR' })}
+          width={16}
+        />
+      </InlineField>
+      <InlineField label="Value">
+        <Input
+          name="value"
+          value={value}
+          placeholder="parameter value. e.g: ${country:druid:json}"
+          onChange={(e: ChangeEvent<HTMLInputElement>) => onChange({ ...parameter, value: [e.target.value] })}
+        />
+      </InlineField>
+    </InlineFieldRow>
+  );
+};
@@ -1,7 +1,7 @@
 import React from 'react';
 import { FieldSet } from '@grafana/ui';
 import { css, cx } from '@emotion/css';
-import { DruidQueryRequestSettings, DruidQueryResponseSettings } from './';
+import { DruidQueryRequestSettings, DruidQueryResponseSettings, DruidQuerySQLParametersSettings } from './';
 import { QuerySettingsProps } from './types';
 
 export const DruidQuerySettings = (props: QuerySettingsProps) => {
@@ -9,6 +9,7 @@ export const DruidQuerySettings = (props: QuerySettingsProps) => {
     <>
       <FieldSet label="Request" className={cx(styles.fieldset)}>
         <DruidQueryRequestSettings {...props} />
+        <DruidQuerySQLParametersSettings {...props} />
       </FieldSet>
       <FieldSet label="Response" className={cx(styles.fieldset)}>
         <DruidQueryResponseSettings {...props} />
@@ -2,5 +2,6 @@ export { DruidQueryDefaultSettings } from './DruidQueryDefaultSettings';
 export { DruidQuerySettings } from './DruidQuerySettings';
 export { DruidQueryRequestSettings } from './DruidQueryRequestSettings';
 export { DruidQueryContextSettings } from './DruidQueryContextSettings';
+export { DruidQuerySQLParametersSettings } from './DruidQuerySQLParametersSettings';
 export { DruidQueryResponseSettings } from './DruidQueryResponseSettings';
 export { DruidQueryLogSettings } from './DruidQueryLogSettings';
@@ -3,15 +3,29 @@ export interface QueryContextParameter {
   value: any;
 }
 
+export interface QuerySQLParameter {
+  type: string;
+  value: any;
+}
+
 export interface QuerySettings {
   format?: string;
   contextParameters?: QueryContextParameter[];
   hideEmptyColumns?: boolean;
+  legacyNullHandling?: boolean;
+  arrayHandling?: string;
+  arraySeparator?: string;
   responseLimit?: number;
+  scanTimeOrder?: string;
   logColumnTime?: string;
   logColumnLevel?: string;
   logColumnMessage?: string;
   debounceTime?: number;
+  disableCache?: boolean;
+  useDashboardTimeRange?: boolean;
+  minInterval?: number;
+  parameters?: QuerySQLParameter[];
+  adhocFiltersDatasource?: string;
 }
 export interface QuerySettingsOptions {
   settings: QuerySettings;
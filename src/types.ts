@@ -12,6 +12,8 @@ export interface DruidQuery extends DataQuery {
 export interface DruidSettings extends DataSourceJsonData {
   connection?: ConnectionSettings;
   query?: QuerySettings;
+  oauthPassThru?: boolean;
+  enableSecureSocksProxy?: boolean;
 }
 
 export interface DruidSecureSettings {}